@@ -0,0 +1,79 @@
+package filesort
+
+// autoTuneMinBuffer is the smallest buffer size tried by AutoTune.
+const autoTuneMinBuffer = 16
+
+// AutoTune is an experimental helper that sorts sampleInput with the given
+// options several times using different memory buffer sizes and returns the
+// size that gives the best balance between the number of spill files and the
+// memory used for the buffer. Spills are counted relative to the smallest
+// buffer tried and memory relative to the size of the sample, so the result
+// is meant for inputs of about the same size as the sample. It is always
+// between autoTuneMinBuffer and len(sampleInput), unless the sample is smaller
+// than autoTuneMinBuffer, in which case it is len(sampleInput) or 1 for an
+// empty sample. Trials that fail are ignored. Options with side effects, such
+// as WithRecord or WithOutputFile, shouldn't be passed.
+func AutoTune(sampleInput []interface{}, opts ...Option) int {
+	n := len(sampleInput)
+	if n <= autoTuneMinBuffer {
+		if n == 0 {
+			return 1
+		}
+		return n
+	}
+	var sizes []int
+	for size := autoTuneMinBuffer; size < n; size *= 2 {
+		sizes = append(sizes, size)
+	}
+	sizes = append(sizes, n)
+
+	spills := make([]int, len(sizes))
+	maxSpills := 1
+	for i, size := range sizes {
+		spills[i] = autoTuneTrial(sampleInput, size, opts)
+		if spills[i] > maxSpills {
+			maxSpills = spills[i]
+		}
+	}
+	best, bestCost := sizes[0], -1.0
+	for i, size := range sizes {
+		if spills[i] < 0 {
+			continue
+		}
+		cost := float64(spills[i])/float64(maxSpills) + float64(size)/float64(n)
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = size, cost
+		}
+	}
+	return best
+}
+
+// autoTuneTrial sorts the sample using the given buffer size and returns the
+// number of spill files written, or -1 if sorting failed.
+func autoTuneTrial(sample []interface{}, size int, opts []Option) int {
+	ps, err := New(append(opts[:len(opts):len(opts)], WithMaxMemoryBuffer(size))...)
+	if err != nil {
+		return -1
+	}
+	for _, v := range sample {
+		if err := ps.Write(v); err != nil {
+			ps.Abort()
+			return -1
+		}
+	}
+	if err := ps.Close(); err != nil {
+		ps.Abort()
+		return -1
+	}
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			return -1
+		}
+		if v == nil {
+			break
+		}
+	}
+	<-ps.done
+	return ps.spills
+}
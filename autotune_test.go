@@ -0,0 +1,28 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAutoTune(t *testing.T) {
+	var sample []interface{}
+	for i := 0; i < 1000; i++ {
+		sample = append(sample, fmt.Sprintf("%04d", (i*7919)%1000))
+	}
+	size := AutoTune(sample,
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+	)
+	if size < autoTuneMinBuffer || size > len(sample) {
+		t.Fatalf("buffer size %d is out of range [%d, %d]", size, autoTuneMinBuffer, len(sample))
+	}
+	// with spill count and memory weighted equally, neither extreme is best
+	if size == autoTuneMinBuffer || size == len(sample) {
+		t.Errorf("expected a buffer size between the extremes, but got %d", size)
+	}
+	if size := AutoTune(sample[:5], WithLess(testLessLine)); size != 5 {
+		t.Errorf("expected buffer size 5 for a small sample, but got %d", size)
+	}
+}
@@ -0,0 +1,107 @@
+package filesort
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BatchLess sorts a whole batch of records at once and returns their order
+// as indices into buf: the index of the record that should come first, then
+// the index of the second one and so on. Equal records must keep their
+// relative order. It lets the memory buffer be sorted by code specialized
+// for the type of the records, e.g. by extracting all the keys into a slice
+// of ints and sorting it, which avoids an interface call per comparison. The
+// slice passed to it is reused, so it must not be retained after it returns.
+type BatchLess func(buf []interface{}) []int
+
+// WithBatchLess sets the function used to sort the memory buffer before it's
+// spilled or merged. The comparison function set with WithLess or
+// WithLessErr is still required to merge the runs and must order records the
+// same way as batch. Records written with WriteWithKey are passed to batch as
+// their keys. It can't be used with WithReverse, WithNullsOrdering,
+// WithHashTieBreak and WithEncodedComparison, as they change the order
+// defined by the comparison function. With WithParallelism batch is called
+// from several goroutines concurrently.
+func WithBatchLess(batch BatchLess) Option {
+	return func(ps *FileSort) {
+		ps.batchLess = batch
+	}
+}
+
+// batchScratch holds the slices sortRecords needs to apply BatchLess, so
+// they are reused by the following flushes instead of being allocated for
+// every one. With WithParallelism several of them are in use at once, so
+// they are kept in a sync.Pool.
+type batchScratch struct {
+	buf    []interface{}
+	sorted []interface{}
+	seen   []bool
+}
+
+var batchScratchPool = sync.Pool{New: func() interface{} { return new(batchScratch) }}
+
+// grow makes the slices of the scratch hold n elements and clears seen.
+func (sc *batchScratch) grow(n int) {
+	if cap(sc.sorted) < n {
+		sc.buf = make([]interface{}, n)
+		sc.sorted = make([]interface{}, n)
+		sc.seen = make([]bool, n)
+		return
+	}
+	sc.buf = sc.buf[:n]
+	sc.sorted = sc.sorted[:n]
+	sc.seen = sc.seen[:n]
+	for i := range sc.seen {
+		sc.seen[i] = false
+	}
+}
+
+// release clears the records from the scratch, so it doesn't keep them from
+// being collected, and returns it to the pool.
+func (sc *batchScratch) release() {
+	for i := range sc.sorted {
+		sc.buf[i] = nil
+		sc.sorted[i] = nil
+	}
+	batchScratchPool.Put(sc)
+}
+
+// sortRecords sorts the records in place using BatchLess if it's set, or the
+// comparison function otherwise.
+func (ps *FileSort) sortRecords(records []interface{}) error {
+	if ps.batchLess == nil {
+		sort.SliceStable(records, func(i, j int) bool { return ps.less(records[i], records[j]) })
+		return ps.compareErr()
+	}
+	sc := batchScratchPool.Get().(*batchScratch)
+	defer sc.release()
+	sc.grow(len(records))
+	buf := records
+	if ps.keyed || ps.withIndex {
+		buf = sc.buf
+		for i, v := range records {
+			if ir, ok := v.(IndexedRecord); ok {
+				v = ir.Value
+			}
+			if kr, ok := v.(keyedRecord); ok {
+				v = kr.key
+			}
+			buf[i] = v
+		}
+	}
+	order := ps.batchLess(buf)
+	if len(order) != len(records) {
+		return fmt.Errorf("batch comparison returned %d indices for %d records", len(order), len(records))
+	}
+	sorted, seen := sc.sorted, sc.seen
+	for i, j := range order {
+		if j < 0 || j >= len(records) || seen[j] {
+			return fmt.Errorf("batch comparison returned invalid index %d", j)
+		}
+		seen[j] = true
+		sorted[i] = records[j]
+	}
+	copy(records, sorted)
+	return nil
+}
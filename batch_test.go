@@ -0,0 +1,158 @@
+package filesort
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func lessInt64(a, b interface{}) bool { return a.(int64) < b.(int64) }
+
+// int64Key is an int64 record extracted from the batch with its index.
+type int64Key struct {
+	v int64
+	i int
+}
+
+// int64Keys sorts the keys without boxing or indirect calls. Equal values are
+// ordered by their indices, which keeps the sort stable.
+type int64Keys []int64Key
+
+func (k int64Keys) Len() int      { return len(k) }
+func (k int64Keys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k int64Keys) Less(i, j int) bool {
+	return k[i].v < k[j].v || k[i].v == k[j].v && k[i].i < k[j].i
+}
+
+// batchLessInt64 sorts int64 records by extracting them into a slice of
+// keys.
+func batchLessInt64(buf []interface{}) []int {
+	keys := make(int64Keys, len(buf))
+	for i, v := range buf {
+		keys[i] = int64Key{v.(int64), i}
+	}
+	sort.Sort(keys)
+	order := make([]int, len(keys))
+	for i, k := range keys {
+		order[i] = k.i
+	}
+	return order
+}
+
+func TestBatchLess(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+		WithBatchLess(func(buf []interface{}) []int {
+			// stable counting sort by the first letter
+			var order []int
+			for c := byte('a'); c <= 'z'; c++ {
+				for i, v := range buf {
+					if v.(string)[0] == c {
+						order = append(order, i)
+					}
+				}
+			}
+			return order
+		}),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"c1", "a1", "b1", "a2", "c2", "b2", "a3", "c3", "b3"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	for _, exp := range []string{"a1", "a2", "a3", "b1", "b2", "b3", "c1", "c2", "c3"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %s but got %v", exp, v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+}
+
+func TestBatchLessInvalidOrder(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithBatchLess(func(buf []interface{}) []int { return make([]int, len(buf)) }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Write("b")
+	sort.Write("a")
+	sort.Close()
+	if _, err := sort.Read(); err == nil {
+		t.Error("expected an error for repeated indices")
+	}
+}
+
+// benchmarkBatchLess measures sorting a full memory buffer, without the
+// writing and reading around it, so the cost of the comparisons dominates.
+func benchmarkBatchLess(b *testing.B, batch BatchLess) {
+	r := rand.New(rand.NewSource(1))
+	input := make([]interface{}, 100000)
+	for i := range input {
+		input[i] = r.Int63()
+	}
+	sort, err := New(
+		WithLess(lessInt64),
+		WithBatchLess(batch),
+		WithEncoderNew(newTestIntEncoder),
+		WithDecoderNew(newTestIntDecoder),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sort.Abort()
+	records := make([]interface{}, len(input))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(records, input)
+		b.StartTimer()
+		if err := sort.sortRecords(records); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLessInt64(b *testing.B) { benchmarkBatchLess(b, nil) }
+
+func BenchmarkBatchLessInt64(b *testing.B) { benchmarkBatchLess(b, batchLessInt64) }
+
+func ExampleWithBatchLess() {
+	sort, _ := New(
+		WithLess(lessInt64),
+		WithBatchLess(batchLessInt64),
+		WithEncoderNew(newTestIntEncoder),
+		WithDecoderNew(newTestIntDecoder),
+	)
+	for _, v := range []int64{3, 1, 2} {
+		sort.Write(v)
+	}
+	sort.Close()
+	for {
+		v, _ := sort.Read()
+		if v == nil {
+			break
+		}
+		fmt.Println(v)
+	}
+	// Output:
+	// 1
+	// 2
+	// 3
+}
@@ -0,0 +1,88 @@
+package filesort
+
+import (
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferReuse(t *testing.T) {
+	var spills, collected int32
+	sort, err := New(
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return testIntPtrEncoder{newTestLineEncoder(w)} }),
+		WithDecoderNew(func(r io.Reader) Decoder { return testIntPtrDecoder{newTestLineDecoder(r)} }),
+		WithLess(func(a, b interface{}) bool { return *a.(*int) < *b.(*int) }),
+		WithMaxMemoryBuffer(4),
+		WithBufferReuse(true),
+		WithSpillWarning(func(int) { atomic.AddInt32(&spills, 1) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Abort()
+	// records 0-7 are spilled in two runs and records 8 and 9 are left in
+	// the buffer, which is reused, so its last two slots would hold records
+	// 6 and 7 if they weren't cleared
+	for i := 0; i < 10; i++ {
+		v := new(int)
+		*v = 9 - i
+		if i < 8 {
+			runtime.SetFinalizer(v, func(*int) { atomic.AddInt32(&collected, 1) })
+		}
+		if err := sort.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for start := time.Now(); atomic.LoadInt32(&spills) < 2 || atomic.LoadInt32(&collected) < 8; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected the 8 spilled records to be collected, but %d of them are", atomic.LoadInt32(&collected))
+		}
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	sort.Close()
+	for i := 0; i < 10; i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *v.(*int) != i {
+			t.Errorf("expected %d but got %v", i, *v.(*int))
+		}
+	}
+}
+
+func benchmarkBufferReuse(b *testing.B, reuse bool) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sort, err := New(
+			WithLess(lessInt64),
+			WithEncoderNew(newTestIntEncoder),
+			WithDecoderNew(newTestIntDecoder),
+			WithMaxMemoryBuffer(10000),
+			WithBufferReuse(reuse),
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 100000; j++ {
+			sort.Write(int64((j * 7919) % 100000))
+		}
+		sort.Close()
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkNoBufferReuse(b *testing.B) { benchmarkBufferReuse(b, false) }
+
+func BenchmarkBufferReuse(b *testing.B) { benchmarkBufferReuse(b, true) }
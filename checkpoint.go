@@ -0,0 +1,154 @@
+package filesort
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultCheckpointInterval is the number of records read between the writes
+// of the merge checkpoint.
+const defaultCheckpointInterval = 1000
+
+// mergeCheckpoint keeps track of the records that have been read, so the
+// output can be resumed after them if the process is restarted.
+type mergeCheckpoint struct {
+	path  string
+	every int
+	// key and skipEqual describe the checkpoint loaded on start: records
+	// less than key and the first skipEqual records equal to it are skipped
+	key       interface{}
+	skipEqual int
+	// prev is the last emitted record and equal is the number of emitted
+	// records equal to it
+	prev  interface{}
+	equal int
+	// last is the last read record and lastEqual is the number of read
+	// records equal to it, unsaved is the number of records read since the
+	// checkpoint was written
+	last      interface{}
+	lastEqual int
+	unsaved   int
+}
+
+// WithMergeCheckpoint makes FileSort periodically write into the file at
+// path the last record returned by Read, so if the process is restarted
+// during the merge, the output can be resumed instead of starting over. If
+// the file exists when FileSort is created or reset, the records that have
+// been returned by Read before the checkpoint was written are skipped in the
+// output, provided the same records are written again. The checkpoint is
+// written when Read is called after every 1000 records, so some records
+// that have been read after it are returned again, which is fine for
+// idempotent processing. The file is removed when the end of the output has
+// been read. It can't be used with WithIndex, WithEncodedComparison,
+// WithOutputReverse, WithDebugRunOutput and records written with
+// WriteWithKey.
+func WithMergeCheckpoint(path string) Option {
+	return func(ps *FileSort) {
+		ps.checkpoint = &mergeCheckpoint{path: path, every: defaultCheckpointInterval}
+	}
+}
+
+// loadCheckpoint resets the checkpoint state and reads the checkpoint file if
+// it exists.
+func (ps *FileSort) loadCheckpoint() error {
+	cp := ps.checkpoint
+	cp.key, cp.skipEqual = nil, 0
+	cp.prev, cp.equal = nil, 0
+	cp.last, cp.lastEqual, cp.unsaved = nil, 0, 0
+	file, err := os.Open(cp.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't open merge checkpoint: %v", err)
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return fmt.Errorf("couldn't read merge checkpoint: %v", err)
+	}
+	key, err := ps.newDecoder(r).Decode()
+	if err != nil {
+		return fmt.Errorf("couldn't decode merge checkpoint: %v", err)
+	}
+	cp.key, cp.skipEqual = key, int(binary.BigEndian.Uint64(buf[:]))
+	return nil
+}
+
+// emitted counts the emitted record and returns the number of emitted
+// records equal to it and whether it has been output before the checkpoint
+// and must be skipped.
+func (cp *mergeCheckpoint) emitted(v interface{}, less func(a, b interface{}) bool) (equal int, skip bool) {
+	if cp.prev != nil && !less(cp.prev, v) {
+		cp.equal++
+	} else {
+		cp.equal = 1
+	}
+	cp.prev = v
+	if cp.key == nil {
+		return cp.equal, false
+	}
+	if less(v, cp.key) {
+		return cp.equal, true
+	}
+	if !less(cp.key, v) && cp.skipEqual > 0 {
+		cp.skipEqual--
+		return cp.equal, true
+	}
+	// the output has passed the checkpoint
+	cp.key = nil
+	return cp.equal, false
+}
+
+// checkpointRead records that the output has been read.
+func (ps *FileSort) checkpointRead(out output) {
+	cp := ps.checkpoint
+	cp.last, cp.lastEqual = out.key, out.equal
+	cp.unsaved++
+}
+
+// saveCheckpoint writes the checkpoint file if enough records have been read
+// since it was written. The file is written under a temporary name and
+// renamed, so it's never left incomplete.
+func (ps *FileSort) saveCheckpoint() error {
+	cp := ps.checkpoint
+	if cp.unsaved < cp.every {
+		return nil
+	}
+	file, err := os.Create(cp.path + tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("couldn't create merge checkpoint: %v", err)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(cp.lastEqual))
+	if _, err := file.Write(buf[:]); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't write merge checkpoint: %v", err)
+	}
+	enc := ps.newEncoder(file)
+	if err := enc.Encode(cp.last); err != nil {
+		enc.Close()
+		return fmt.Errorf("couldn't encode merge checkpoint: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("error when closing merge checkpoint: %v", err)
+	}
+	if err := os.Rename(cp.path+tmpSuffix, cp.path); err != nil {
+		return fmt.Errorf("couldn't rename merge checkpoint: %v", err)
+	}
+	cp.unsaved = 0
+	return nil
+}
+
+// removeCheckpoint removes the checkpoint file after the whole output has
+// been read.
+func (ps *FileSort) removeCheckpoint() error {
+	if err := os.Remove(ps.checkpoint.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("couldn't remove merge checkpoint: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package filesort
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+	input := []string{"a1", "b1", "a2", "c1", "b2", "a3", "c2", "b3", "c3"}
+	newSort := func() *FileSort {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithMergeCheckpoint(path),
+			func(ps *FileSort) { ps.checkpoint.every = 2 },
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		return sort
+	}
+	read := func(sort *FileSort, exp []string) {
+		for _, e := range exp {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != e {
+				t.Errorf("expected %s but got %v", e, v)
+			}
+		}
+	}
+	// the process dies after reading 5 records, the checkpoint has been
+	// written before reading the fifth one
+	sort := newSort()
+	read(sort, []string{"a1", "a2", "a3", "b1", "b2"})
+	sort.Abort()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected checkpoint file: %v", err)
+	}
+	// after the restart the output resumes after b1, so b2 is returned
+	// again, but none of the records before it
+	sort = newSort()
+	read(sort, []string{"b2", "b3", "c1", "c2", "c3"})
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected checkpoint file to be removed, but got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package filesort
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCleanup(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		var spills int
+		opts := []Option{
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithIndex(),
+			WithSyncClose(),
+			WithSpillWarning(func(int) { spills++ }),
+		}
+		if reverse {
+			opts = append(opts, WithOutputReverse())
+		}
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			sort.Write(fmt.Sprint(9 - i))
+		}
+		if err := sort.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if spills < 3 {
+			t.Errorf("expected at least 3 spill files, but got %d", spills)
+		}
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+		}
+		if _, err := os.Stat(sort.tempDir); !os.IsNotExist(err) {
+			t.Errorf("reverse %v: expected temporary directory %s to be removed, but got %v", reverse, sort.tempDir, err)
+		}
+	}
+}
+
+func TestMissingSpillFile(t *testing.T) {
+	var sort *FileSort
+	var tempDir string
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		// the spill file is deleted out from under FileSort
+		WithSpillWarning(func(n int) {
+			if n == 2 {
+				tempDir = sort.tempDir
+				os.Remove(sort.files[1])
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(9 - i))
+	}
+	sort.Close()
+	if v, err := sort.Read(); err == nil {
+		t.Fatalf("expected an error for a missing spill file, but got %v", v)
+	}
+	if err := sort.Err(); err == nil {
+		t.Error("expected Err to report the missing spill file")
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("expected temporary directory %s to be removed, but got %v", tempDir, err)
+	}
+}
@@ -1,50 +1,48 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"syscall"
 
 	filesort "gitlab.com/shaydo/go-filesort"
 	"gitlab.com/shaydo/go-filesort/text"
 )
 
-func main() {
-	src := os.Args[1]
+// sortFile sorts lines of the src file and writes them to out. If a value is
+// received from stop before sorting is complete, the sort is aborted and its
+// temporary files are removed. opts are passed to the sort after the default
+// ones.
+func sortFile(src string, out io.Writer, bufferSize int, stop <-chan os.Signal, opts ...filesort.Option) error {
 	in, err := os.Open(src)
 	if err != nil {
-		panic(err)
-	}
-	bin := bufio.NewReader(in)
-	sort, err := filesort.New(
-		filesort.WithLess(text.Less),
-		filesort.WithEncoderNew(text.NewEncoder),
-		filesort.WithDecoderNew(text.NewDecoder),
-		filesort.WithMaxMemoryBuffer(1024*1024),
-	)
-	if err != nil {
-		panic(err)
-	}
-	for {
-		line, err := bin.ReadString('\n')
-		if err != nil {
-			break
-		}
-		if err := sort.Write(line); err != nil {
-			panic(err)
-		}
+		return err
 	}
-	sort.Close()
-	bout := bufio.NewWriter(os.Stdout)
-	for {
-		out, err := sort.Read()
-		if err != nil {
-			panic(err)
-		}
-		if out == nil {
-			break
+	defer in.Close()
+	// the sort is aborted as soon as the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
 		}
-		fmt.Fprint(bout, out)
+	}()
+	return text.SortReader(in, out, append([]filesort.Option{
+		filesort.WithMaxMemoryBuffer(bufferSize),
+		filesort.WithContext(ctx),
+	}, opts...)...)
+}
+
+func main() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	if err := sortFile(os.Args[1], os.Stdout, 1024*1024, stop); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	bout.Flush()
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+func TestSortFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sorttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "input")
+	// the last line has no trailing newline
+	if err := ioutil.WriteFile(src, []byte("c\na\nd\nb"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := sortFile(src, &out, 2, make(chan os.Signal)); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "a\nb\nc\nd\n"; out.String() != exp {
+		t.Errorf("expected %q but got %q", exp, out.String())
+	}
+}
+
+func TestSortFileInterrupted(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sorttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "input")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(w, "%d\n", (i*7919)%10000)
+	}
+	w.Flush()
+	f.Close()
+	spill := filepath.Join(tmp, "spill")
+	if err := os.Mkdir(spill, 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", spill)
+
+	stop := make(chan os.Signal, 1)
+	spilled := 0
+	// interrupt the sort once the first spill file has been written
+	interrupt := filesort.WithSpillWarning(func(spillNumber int) {
+		if spillNumber != 1 {
+			return
+		}
+		filepath.Walk(spill, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				spilled++
+			}
+			return nil
+		})
+		stop <- os.Interrupt
+	})
+	err = sortFile(src, ioutil.Discard, 100, stop, interrupt)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, but got %v", err)
+	}
+	if spilled == 0 {
+		t.Error("expected a spill file before the interrupt")
+	}
+	left, err := ioutil.ReadDir(spill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("expected temporary files to be removed, but found %d entries", len(left))
+	}
+}
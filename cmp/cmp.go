@@ -0,0 +1,29 @@
+// Package cmp implements comparison functions for filesort.
+package cmp
+
+import (
+	"math"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// LessFloat64Tol returns a function that compares float64 records and treats
+// the values that differ by at most tol as equal, so records whose values
+// differ only by rounding errors keep the order they have been written in.
+// NaNs come after all the numbers.
+//
+// Note that this is not a strict weak order: 1.0 and 1.6 are equal with tol
+// 0.5, and so are 1.6 and 2.2, but 1.0 comes before 2.2. For such chains of
+// values the output depends on how records were split between the runs, so
+// it's only well defined if groups of values are farther than tol from each
+// other. Use it together with filesort.WithTransitivityCheck to detect the
+// chains in the input.
+func LessFloat64Tol(tol float64) filesort.Less {
+	return func(a, b interface{}) bool {
+		fa, fb := a.(float64), b.(float64)
+		if math.IsNaN(fa) || math.IsNaN(fb) {
+			return !math.IsNaN(fa)
+		}
+		return fb-fa > tol
+	}
+}
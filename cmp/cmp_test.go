@@ -0,0 +1,63 @@
+package cmp
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+	"gitlab.com/shaydo/go-filesort/gob"
+)
+
+func sortFloats(t *testing.T, input []float64, opts ...filesort.Option) ([]float64, error) {
+	sort, err := filesort.New(append([]filesort.Option{
+		filesort.WithLess(LessFloat64Tol(0.01)),
+		filesort.WithEncoderNew(gob.NewEncoder),
+		filesort.WithDecoderNew(gob.NewDecoder),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range input {
+		sort.Write(v)
+	}
+	sort.Close()
+	var res []float64
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return res, nil
+		}
+		res = append(res, v.(float64))
+	}
+}
+
+func TestLessFloat64Tol(t *testing.T) {
+	input := []float64{1.002, math.NaN(), 2.005, 1.0, 3.0, 1.001, 2.0}
+	res, err := sortFloats(t, input, filesort.WithMaxMemoryBuffer(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// values within the tolerance keep the input order
+	exp := []float64{1.002, 1.0, 1.001, 2.005, 2.0, 3.0}
+	if len(res) != len(exp)+1 || !math.IsNaN(res[len(exp)]) {
+		t.Fatalf("expected %v followed by NaN, but got %v", exp, res)
+	}
+	for i := range exp {
+		if res[i] != exp[i] {
+			t.Errorf("expected %v at %d, but got %v", exp[i], i, res[i])
+		}
+	}
+}
+
+func TestLessFloat64TolChain(t *testing.T) {
+	// every value is within the tolerance of the next one
+	input := []float64{1.0, 1.006, 1.012, 1.018}
+	_, err := sortFloats(t, input, filesort.WithRandSeed(1), filesort.WithTransitivityCheck(100))
+	if err == nil || !strings.Contains(err.Error(), "isn't transitive") {
+		t.Errorf("expected transitivity error, but got %v", err)
+	}
+}
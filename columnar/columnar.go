@@ -0,0 +1,174 @@
+// Package columnar implements methods that enable filesort to sort slices of
+// strings that are stored to disk in columnar layout. Records are written in
+// blocks, inside of a block all the values of the first field come first,
+// followed by all the values of the second field and so on. The block is then
+// compressed, which works much better for column-major data if the records
+// are homogeneous. All the records in a block must have the same number of
+// fields.
+package columnar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// BlockSize is the maximum number of records in a block.
+const BlockSize = 4096
+
+type columnarEncoder struct {
+	w    io.WriteCloser
+	bw   *bufio.Writer
+	rows [][]string
+}
+
+// NewEncoder returns filesort.Encoder that encodes slices of strings in
+// columnar layout for storing into file. The returned Encoder also
+// implements filesort.BatchEncoder.
+func NewEncoder(w io.WriteCloser) filesort.Encoder {
+	return &columnarEncoder{w: w, bw: bufio.NewWriter(w)}
+}
+
+func (ce *columnarEncoder) Encode(row interface{}) error {
+	ce.rows = append(ce.rows, row.([]string))
+	if len(ce.rows) >= BlockSize {
+		return ce.writeBlock()
+	}
+	return nil
+}
+
+func (ce *columnarEncoder) EncodeBatch(rows []interface{}) error {
+	for _, row := range rows {
+		if err := ce.Encode(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (ce *columnarEncoder) writeBlock() error {
+	if len(ce.rows) == 0 {
+		return nil
+	}
+	cols := len(ce.rows[0])
+	var raw bytes.Buffer
+	putUvarint(&raw, uint64(len(ce.rows)))
+	putUvarint(&raw, uint64(cols))
+	for _, row := range ce.rows {
+		if len(row) != cols {
+			return fmt.Errorf("record has %d fields, but %d are expected", len(row), cols)
+		}
+	}
+	for c := 0; c < cols; c++ {
+		for _, row := range ce.rows {
+			putUvarint(&raw, uint64(len(row[c])))
+			raw.WriteString(row[c])
+		}
+	}
+	ce.rows = ce.rows[:0]
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(raw.Bytes()); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	var header bytes.Buffer
+	putUvarint(&header, uint64(compressed.Len()))
+	if _, err := ce.bw.Write(header.Bytes()); err != nil {
+		return err
+	}
+	_, err = ce.bw.Write(compressed.Bytes())
+	return err
+}
+
+func (ce *columnarEncoder) Close() error {
+	err := ce.writeBlock()
+	if err == nil {
+		err = ce.bw.Flush()
+	}
+	if err != nil {
+		ce.w.Close()
+		return err
+	}
+	return ce.w.Close()
+}
+
+type columnarDecoder struct {
+	r    *bufio.Reader
+	rows [][]string
+}
+
+// NewDecoder returns filesort.Decoder that reads slices of strings encoded in
+// columnar layout.
+func NewDecoder(r io.Reader) filesort.Decoder {
+	return &columnarDecoder{r: bufio.NewReader(r)}
+}
+
+func (cd *columnarDecoder) Decode() (interface{}, error) {
+	if len(cd.rows) == 0 {
+		if err := cd.readBlock(); err != nil {
+			return nil, err
+		}
+	}
+	row := cd.rows[0]
+	cd.rows = cd.rows[1:]
+	return row, nil
+}
+
+func (cd *columnarDecoder) readBlock() error {
+	size, err := binary.ReadUvarint(cd.r)
+	if err != nil {
+		return err
+	}
+	raw, err := ioutil.ReadAll(flate.NewReader(io.LimitReader(cd.r, int64(size))))
+	if err != nil {
+		return fmt.Errorf("couldn't decompress a block: %v", err)
+	}
+	br := bytes.NewReader(raw)
+	rows, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("couldn't read number of records: %v", err)
+	}
+	cols, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("couldn't read number of fields: %v", err)
+	}
+	if rows == 0 || rows > uint64(len(raw)) || cols > uint64(len(raw)) {
+		return fmt.Errorf("invalid block header: %d records with %d fields", rows, cols)
+	}
+	cd.rows = make([][]string, rows)
+	for i := range cd.rows {
+		cd.rows[i] = make([]string, cols)
+	}
+	for c := 0; c < int(cols); c++ {
+		for _, row := range cd.rows {
+			l, err := binary.ReadUvarint(br)
+			if err != nil {
+				return fmt.Errorf("couldn't read field length: %v", err)
+			}
+			if l > uint64(br.Len()) {
+				return fmt.Errorf("field length %d exceeds the block size", l)
+			}
+			val := make([]byte, l)
+			br.Read(val)
+			row[c] = string(val)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package columnar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+	"gitlab.com/shaydo/go-filesort/csv"
+)
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (bc *bufferCloser) Close() error { return nil }
+
+func less(a, b interface{}) bool {
+	sa, sb := a.([]string), b.([]string)
+	if sa[1] < sb[1] || (sa[1] == sb[1] && sa[0] < sb[0]) {
+		return true
+	}
+	return false
+}
+
+func Example() {
+	sort, err := filesort.New(
+		filesort.WithLess(less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+	)
+	if err != nil {
+		panic(err)
+	}
+	sort.Write([]string{"Danny", "35", "66"})
+	sort.Write([]string{"Alice", "35", "70"})
+	sort.Write([]string{"Bob", "7", "84"})
+	sort.Close()
+	for {
+		res, err := sort.Read()
+		if err != nil {
+			panic(err)
+		}
+		if res == nil {
+			// end of output
+			break
+		}
+		fmt.Println(strings.Join(res.([]string), ","))
+	}
+	// Output:
+	// Alice,35,70
+	// Danny,35,66
+	// Bob,7,84
+}
+
+func TestColumnarSort(t *testing.T) {
+	sort, err := filesort.New(
+		filesort.WithLess(less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := [][]string{
+		{"one", "d", "horse"},
+		{"two", "c", "rhinoceros"},
+		{"three", "a", ",\nStickly-Prickly,Hedgehog\n"},
+		{"one", "c", "cat"},
+		{"two", "a", "elefant"},
+		{"three", "b", ""},
+		{"one", "e", "cow"},
+		{"two", "b", `"Slow-Solid",Tortoise`},
+		{"three", "d", "armadillo"},
+	}
+	for _, str := range input {
+		if err := sort.Write(str); err != nil {
+			t.Fatalf("write has failed: %v", err)
+		}
+	}
+	sort.Close()
+	expected := [][]string{
+		{"three", "a", ",\nStickly-Prickly,Hedgehog\n"},
+		{"two", "a", "elefant"},
+		{"three", "b", ""},
+		{"two", "b", `"Slow-Solid",Tortoise`},
+		{"one", "c", "cat"},
+		{"two", "c", "rhinoceros"},
+		{"one", "d", "horse"},
+		{"three", "d", "armadillo"},
+		{"one", "e", "cow"},
+	}
+	for _, e := range expected {
+		str := strings.Join(e, "/")
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatalf("couldn't read: %v", err)
+		}
+		if got := strings.Join(s.([]string), "/"); got != str {
+			t.Errorf("expected %s but got %s", str, got)
+		}
+	}
+	s, err := sort.Read()
+	if s != nil || err != nil {
+		t.Errorf("expected EOF, but got: %v %v", s, err)
+	}
+}
+
+func TestColumnarSize(t *testing.T) {
+	var rows []interface{}
+	for i := 0; i < 10000; i++ {
+		rows = append(rows, []string{fmt.Sprintf("user-%05d", i/10), []string{"GET", "POST"}[i%2], "/index.html", "200"})
+	}
+	col, row := &bufferCloser{}, &bufferCloser{}
+	enc := NewEncoder(col)
+	if err := enc.(filesort.BatchEncoder).EncodeBatch(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	csvEnc := csv.NewEncoder(row)
+	for _, r := range rows {
+		if err := csvEnc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := csvEnc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if col.Len() >= row.Len() {
+		t.Errorf("expected columnar encoding to be smaller than CSV, but got %d and %d bytes", col.Len(), row.Len())
+	}
+	dec := NewDecoder(col)
+	for i, r := range rows {
+		v, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("couldn't decode record %d: %v", i, err)
+		}
+		if got, exp := strings.Join(v.([]string), ","), strings.Join(r.([]string), ","); got != exp {
+			t.Fatalf("expected %s but got %s", exp, got)
+		}
+	}
+	if v, err := dec.Decode(); v != nil || err == nil {
+		t.Errorf("expected EOF, but got: %v %v", v, err)
+	}
+}
@@ -0,0 +1,137 @@
+package filesort
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// mergeRuns merges the spill files into a new one and returns its name. The
+// merged files are not removed.
+func (ps *FileSort) mergeRuns(names []string) (string, error) {
+	var readers []Reader
+	readAhead := ps.readAheadSize(len(names))
+	for _, name := range names {
+		fr, err := ps.makeFileReader(name, readAhead)
+		if err != nil {
+			return "", fmt.Errorf("couldn't open a spill file: %v", err)
+		}
+		defer fr.Close()
+		readers = append(readers, fr)
+	}
+	mr, err := newMergeReader(ps.less, readers)
+	if err != nil {
+		return "", err
+	}
+	name, err := ps.writeRunFunc(ps.tempDir, func(enc Encoder) error {
+		for {
+			v, err := ps.nextMerged(mr)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				return nil
+			}
+			if err := enc.Encode(v); err != nil {
+				return fmt.Errorf("couldn't encode a value: %v", err)
+			}
+		}
+	})
+	if err != nil {
+		return name, err
+	}
+	size, err := ps.runSize(name)
+	if err != nil {
+		return name, fmt.Errorf("couldn't get the size of a merged file: %v", err)
+	}
+	atomic.AddInt64(&ps.stats.BytesSpilled, size)
+	return name, nil
+}
+
+// compact merges some of the spill files together if their number exceeds
+// the threshold set with WithCompactThreshold. It picks the sequence of
+// adjacent files with the smallest total size, so the merged file takes
+// their place in the order of runs and the sort stays stable.
+func (ps *FileSort) compact() error {
+	if ps.compactThreshold <= 0 || len(ps.files) <= ps.compactThreshold {
+		return nil
+	}
+	window := (ps.compactThreshold + 1) / 2
+	if window < 2 {
+		window = 2
+	}
+	sizes := make([]int64, len(ps.files))
+	for i, name := range ps.files {
+		size, err := ps.runSize(name)
+		if err != nil {
+			return fmt.Errorf("couldn't get the size of a spill file: %v", err)
+		}
+		sizes[i] = size
+	}
+	start := 0
+	var best int64 = -1
+	for i := 0; i+window <= len(sizes); i++ {
+		var total int64
+		for _, size := range sizes[i : i+window] {
+			total += size
+		}
+		if best < 0 || total < best {
+			start, best = i, total
+		}
+	}
+	runs := ps.files[start : start+window]
+	atomic.AddInt64(&ps.stats.MergePasses, 1)
+	name, err := ps.mergeRuns(runs)
+	if err != nil {
+		if name != "" {
+			ps.removeRun(name)
+		}
+		return err
+	}
+	for _, run := range runs {
+		ps.removeRun(run)
+	}
+	files := append([]string{}, ps.files[:start]...)
+	files = append(files, name)
+	ps.files = append(files, ps.files[start+window:]...)
+	return nil
+}
+
+// reduceRuns merges the spill files in passes until their number doesn't
+// exceed the limit set with WithMaxOpenFiles, so the final merge doesn't
+// open more files at once. Each pass merges groups of adjacent files, so the
+// sort stays stable.
+func (ps *FileSort) reduceRuns() error {
+	if ps.maxOpenFiles <= 0 {
+		return nil
+	}
+	for len(ps.files) > ps.maxOpenFiles {
+		atomic.AddInt64(&ps.stats.MergePasses, 1)
+		var files []string
+		for start := 0; start < len(ps.files); start += ps.maxOpenFiles {
+			end := start + ps.maxOpenFiles
+			if end > len(ps.files) {
+				end = len(ps.files)
+			}
+			runs := ps.files[start:end]
+			if len(runs) == 1 {
+				files = append(files, runs[0])
+				continue
+			}
+			name, err := ps.mergeRuns(runs)
+			if err != nil {
+				if name != "" {
+					ps.removeRun(name)
+				}
+				// keep track of all the files, so they are removed
+				ps.files = append(files, ps.files[start:]...)
+				return err
+			}
+			for _, run := range runs {
+				ps.removeRun(run)
+			}
+			files = append(files, name)
+		}
+		ps.files = files
+	}
+	return nil
+}
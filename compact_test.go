@@ -0,0 +1,98 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompactThreshold(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(2),
+		WithCompactThreshold(4),
+		WithSyncClose(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []string
+	for i := 0; i < 40; i++ {
+		input = append(input, fmt.Sprintf("%d%02d", (i*7)%3, i))
+		sort.Write(input[i])
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// without compaction there would be 20 spill files
+	if n := len(sort.files); n > 4 {
+		t.Errorf("expected at most 4 spill files, but got %d", n)
+	}
+	var expected []string
+	for k := byte('0'); k <= '2'; k++ {
+		for _, s := range input {
+			if s[0] == k {
+				expected = append(expected, s)
+			}
+		}
+	}
+	for _, exp := range expected {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != exp {
+			t.Errorf("expected %s but got %v", exp, s)
+		}
+	}
+	if s, err := sort.Read(); s != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", s, err)
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(2),
+		WithMaxOpenFiles(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []string
+	for i := 0; i < 40; i++ {
+		input = append(input, fmt.Sprintf("%d%02d", (i*7)%3, i))
+		sort.Write(input[i])
+	}
+	sort.Close()
+	var expected []string
+	for k := byte('0'); k <= '2'; k++ {
+		for _, s := range input {
+			if s[0] == k {
+				expected = append(expected, s)
+			}
+		}
+	}
+	for _, exp := range expected {
+		// 20 spill files are merged in passes into 7 and then 3 files
+		s, run, err := sort.ReadWithOrigin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != exp {
+			t.Errorf("expected %s but got %v", exp, s)
+		}
+		if run < 0 || run >= 3 {
+			t.Errorf("expected the record to come from one of 3 runs, but got run %d", run)
+		}
+	}
+	if s, err := sort.Read(); s != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", s, err)
+	}
+	if _, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxOpenFiles(1)); err == nil {
+		t.Error("expected an error for a single open file")
+	}
+}
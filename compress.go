@@ -0,0 +1,70 @@
+package filesort
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// WithCompression makes FileSort compress spill files with gzip using the
+// given compression level, e.g. gzip.BestSpeed, which reduces the disk space
+// needed for temporary files at the cost of CPU time. It can't be used with
+// WithPlainTextSpill.
+func WithCompression(level int) Option {
+	return func(ps *FileSort) {
+		ps.compress = true
+		ps.compressLevel = level
+	}
+}
+
+// checkCompression returns an error if the compression options are invalid.
+func (ps *FileSort) checkCompression() error {
+	if !ps.compress {
+		return nil
+	}
+	if ps.plainTextSpill {
+		return fmt.Errorf("compression can't be used with plain text spill")
+	}
+	if ps.compressLevel < gzip.HuffmanOnly || ps.compressLevel > gzip.BestCompression {
+		return fmt.Errorf("invalid compression level %d", ps.compressLevel)
+	}
+	return nil
+}
+
+// gzipWriteCloser closes the gzip layer before the underlying writer.
+type gzipWriteCloser struct {
+	*gzip.Writer
+	w io.WriteCloser
+}
+
+func (gw gzipWriteCloser) Close() error {
+	if err := gw.Writer.Close(); err != nil {
+		gw.w.Close()
+		return err
+	}
+	return gw.w.Close()
+}
+
+// compressWriter wraps the spill file into the gzip writer if compression is
+// enabled.
+func (ps *FileSort) compressWriter(w io.WriteCloser) io.WriteCloser {
+	if !ps.compress {
+		return w
+	}
+	// the level has been checked in New
+	gz, _ := gzip.NewWriterLevel(w, ps.compressLevel)
+	return gzipWriteCloser{Writer: gz, w: w}
+}
+
+// decompressReader returns the reader of the decompressed content of the
+// spill file if compression is enabled.
+func (ps *FileSort) decompressReader(r io.Reader) (io.Reader, error) {
+	if !ps.compress {
+		return r, nil
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read compressed spill file: %v", err)
+	}
+	return gz, nil
+}
@@ -0,0 +1,73 @@
+package filesort
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	run := func(opts ...Option) []interface{} {
+		opts = append(opts,
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(7),
+		)
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprintf("%03d", (i*37)%100))
+		}
+		sort.Close()
+		var res []interface{}
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				return res
+			}
+			res = append(res, v)
+		}
+	}
+	var checked bool
+	var sort *FileSort
+	compressed := run(WithCompression(gzip.BestSpeed), WithOutputTransform(func(v interface{}) (interface{}, error) {
+		if !checked {
+			// the merge has just started, so the spill files are there
+			checked = true
+			data, err := ioutil.ReadFile(sort.files[0])
+			if err != nil {
+				t.Error(err)
+			} else if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+				t.Errorf("spill file is not compressed: %q", data)
+			}
+		}
+		return v, nil
+	}), func(ps *FileSort) { sort = ps })
+	plain := run()
+	if !reflect.DeepEqual(compressed, plain) {
+		t.Errorf("output with compression %v differs from output without it %v", compressed, plain)
+	}
+	if len(plain) != 100 || !checked {
+		t.Errorf("expected 100 records and checked spill file, but got %d records", len(plain))
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithCompression(gzip.BestSpeed), WithPlainTextSpill()},
+		{WithCompression(42)},
+	} {
+		opts = append(opts, WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+		if _, err := New(opts...); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package filesort
+
+// Config describes the effective configuration of FileSort.
+type Config struct {
+	// MaxMemoryBuffer is the maximum number of records held in memory
+	MaxMemoryBuffer int
+	// MaxMemoryBytes is the maximum size of records held in memory in bytes,
+	// or 0 if the limit is set by the number of records
+	MaxMemoryBytes int64
+	// NoSpill is true if spilling records to disk is forbidden
+	NoSpill bool
+	// KeyCacheSize is the size of the key cache, or 0 if it isn't used
+	KeyCacheSize int
+	// OutputReverse is true if the output is in the reverse order
+	OutputReverse bool
+	// Reverse is true if records are sorted in descending order
+	Reverse bool
+	// Unique is true if only one record of every group of equal records is
+	// output
+	Unique bool
+	// Limit is the maximum number of records output, or 0 if there's no
+	// limit
+	Limit int
+	// Parallelism is the number of goroutines sorting and spilling full
+	// memory buffers
+	Parallelism int
+	// Index is true if records are returned with their input indices
+	Index bool
+	// RandSeed is the seed of the random number generator
+	RandSeed int64
+	// TempDir is the directory for temporary files, or empty string if the
+	// system temporary directory is used
+	TempDir string
+}
+
+// Config returns the configuration of FileSort resolved from the options
+// passed to New.
+func (ps *FileSort) Config() Config {
+	cfg := Config{
+		MaxMemoryBuffer: ps.bufferMax,
+		MaxMemoryBytes:  ps.maxBytes,
+		NoSpill:         ps.noSpill,
+		OutputReverse:   ps.outputReverse,
+		Reverse:         ps.reverse,
+		Unique:          ps.unique,
+		Limit:           ps.limit,
+		Parallelism:     1,
+		Index:           ps.withIndex,
+		RandSeed:        ps.seed,
+		TempDir:         ps.tempParent,
+	}
+	if ps.parallelism > 1 {
+		cfg.Parallelism = ps.parallelism
+	}
+	if ps.keyCache != nil {
+		cfg.KeyCacheSize = ps.keyCache.size
+	}
+	return cfg
+}
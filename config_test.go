@@ -0,0 +1,37 @@
+package filesort
+
+import "testing"
+
+func TestConfig(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(42),
+		WithNoSpill(),
+		WithKeyCache(16, func(v interface{}) interface{} { return v }),
+		WithRandSeed(7),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Close()
+	exp := Config{
+		MaxMemoryBuffer: 42,
+		NoSpill:         true,
+		KeyCacheSize:    16,
+		Parallelism:     1,
+		RandSeed:        7,
+	}
+	if cfg := sort.Config(); cfg != exp {
+		t.Errorf("expected config %+v but got %+v", exp, cfg)
+	}
+	sort, err = New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Close()
+	if cfg := sort.Config(); cfg.MaxMemoryBuffer != 1048576 || cfg.NoSpill || cfg.KeyCacheSize != 0 || cfg.Parallelism != 1 {
+		t.Errorf("unexpected default config %+v", cfg)
+	}
+}
@@ -0,0 +1,233 @@
+package filesort
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// encodedSize returns the number of bytes the record takes when encoded on
+// its own with the configured Encoder.
+func (ps *FileSort) encodedSize(v interface{}) (int64, error) {
+	var buf bytes.Buffer
+	enc := ps.newEncoder(nopWriteCloser{&buf})
+	if err := enc.Encode(v); err != nil {
+		return 0, err
+	}
+	if err := enc.Close(); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+// ConsumeSizeLimited reads all sorted records and writes them out using the
+// configured Encoder into a sequence of outputs returned by sink, which is
+// called with the index of the output starting from 0. A new output is
+// started whenever writing the next record would make the current one larger
+// than maxBytes. Records are never split between outputs, so a record that is
+// bigger than maxBytes on its own is written to a separate output. The size of
+// a record is measured by encoding it separately, which may be an
+// overestimate for encoders that write per-stream headers.
+func (ps *FileSort) ConsumeSizeLimited(maxBytes int64, sink func(index int) (io.WriteCloser, error)) error {
+	var (
+		enc   Encoder
+		index int
+		size  int64
+	)
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			if enc != nil {
+				enc.Close()
+			}
+			return err
+		}
+		if v == nil {
+			break
+		}
+		n, err := ps.encodedSize(v)
+		if err != nil {
+			if enc != nil {
+				enc.Close()
+			}
+			return fmt.Errorf("couldn't encode a value: %v", err)
+		}
+		if enc != nil && size+n > maxBytes {
+			if err := enc.Close(); err != nil {
+				return fmt.Errorf("error when closing encoder: %v", err)
+			}
+			enc = nil
+			index++
+		}
+		if enc == nil {
+			w, err := sink(index)
+			if err != nil {
+				return fmt.Errorf("couldn't create output %d: %v", index, err)
+			}
+			enc = ps.newEncoder(w)
+			size = 0
+		}
+		if err := enc.Encode(v); err != nil {
+			enc.Close()
+			return fmt.Errorf("couldn't encode a value: %v", err)
+		}
+		size += n
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("error when closing encoder: %v", err)
+		}
+	}
+	return nil
+}
+
+// ConsumeMulti reads all sorted records and writes each of them to all the
+// encoders, closing them in the end. If one of the encoders fails, the rest
+// of them still receive the whole output. The returned error describes
+// failures of all the encoders.
+func (ps *FileSort) ConsumeMulti(encoders ...Encoder) error {
+	errs := make([]error, len(encoders))
+	var readErr error
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			readErr = err
+			break
+		}
+		if v == nil {
+			break
+		}
+		for i, enc := range encoders {
+			if errs[i] != nil {
+				continue
+			}
+			if err := enc.Encode(v); err != nil {
+				errs[i] = fmt.Errorf("couldn't encode a value: %v", err)
+			}
+		}
+	}
+	for i, enc := range encoders {
+		if err := enc.Close(); err != nil && errs[i] == nil {
+			errs[i] = fmt.Errorf("error when closing encoder: %v", err)
+		}
+	}
+	var msgs []string
+	if readErr != nil {
+		msgs = append(msgs, readErr.Error())
+	}
+	for i, err := range errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("encoder %d: %v", i, err))
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// SortToFile creates a new FileSort with opts and sorts the records read
+// with the configured Decoder from the file specified with WithInputFile. It
+// writes the sorted records using the configured Encoder into the file
+// specified with WithOutputFile, or into a new file in the temporary
+// directory if the option hasn't been used, without returning them through
+// Read. It returns the path to the file, which is owned by the caller.
+func SortToFile(opts ...Option) (path string, err error) {
+	ps, err := New(opts...)
+	if err != nil {
+		return "", err
+	}
+	defer ps.Abort()
+	if ps.inputFile == "" {
+		return "", errors.New("input file is required")
+	}
+	in, err := os.Open(ps.inputFile)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open input file: %v", err)
+	}
+	defer in.Close()
+	if err := ps.ReplayFrom(in); err != nil {
+		return "", err
+	}
+	if err := ps.Close(); err != nil {
+		return "", err
+	}
+	return ps.writeOutputFile()
+}
+
+// writeOutputFile reads all sorted records and writes them into the output
+// file of SortToFile. In case of error the partially written file is removed.
+func (ps *FileSort) writeOutputFile() (string, error) {
+	var file *os.File
+	var err error
+	if ps.outputFile != "" {
+		file, err = os.Create(ps.outputFile)
+	} else {
+		file, err = ioutil.TempFile(ps.tempParent, "filesort-out")
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't create output file: %v", err)
+	}
+	if err := ps.encodeOutput(file); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// encodeOutput reads all sorted records and writes them into w using the
+// configured Encoder, closing w in the end.
+func (ps *FileSort) encodeOutput(w io.WriteCloser) error {
+	enc := ps.newEncoder(w)
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			enc.Close()
+			return err
+		}
+		if v == nil {
+			break
+		}
+		if err := enc.Encode(v); err != nil {
+			enc.Close()
+			return fmt.Errorf("couldn't encode a value: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("error when closing encoder: %v", err)
+	}
+	return nil
+}
+
+// PipeTo reads all sorted records and writes them to dst, closing its input in
+// the end. Since sorting is stable, this can be used to sort by several keys
+// in turn, starting from the least significant one: records that are equal
+// according to dst's comparison function keep the order established by
+// ps. If reading from ps or writing to dst fails, dst is aborted with the
+// error, so it never outputs a part of the records as if it were all of them.
+func (ps *FileSort) PipeTo(dst *FileSort) error {
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			dst.abortWith(err)
+			return err
+		}
+		if v == nil {
+			return dst.Close()
+		}
+		if err := dst.Write(v); err != nil {
+			dst.abortWith(err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package filesort
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestConsumeSizeLimited(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for i := 0; i < 20; i++ {
+		s := fmt.Sprintf("%03d", (i*7)%20)
+		expected = append(expected, s)
+		if err := sort.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Close()
+	var outputs []*bytes.Buffer
+	sink := func(index int) (io.WriteCloser, error) {
+		if index != len(outputs) {
+			t.Errorf("expected output index %d but got %d", len(outputs), index)
+		}
+		buf := &bytes.Buffer{}
+		outputs = append(outputs, buf)
+		return nopWriteCloser{buf}, nil
+	}
+	// every record takes 4 bytes, so each output should fit 2 records
+	if err := sort.ConsumeSizeLimited(10, sink); err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 10 {
+		t.Errorf("expected 10 outputs, but got %d", len(outputs))
+	}
+	var all string
+	for i, out := range outputs {
+		if out.Len() > 10 {
+			t.Errorf("output %d is %d bytes long", i, out.Len())
+		}
+		all += out.String()
+	}
+	lines := strings.Split(strings.TrimRight(all, "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d records, but got %d", len(expected), len(lines))
+	}
+	for i, l := range lines {
+		if exp := fmt.Sprintf("%03d", i); l != exp {
+			t.Errorf("expected %s but got %s", exp, l)
+		}
+	}
+}
+
+type testCSVEncoder struct {
+	w  io.WriteCloser
+	cw *csv.Writer
+}
+
+func (ce *testCSVEncoder) Encode(v interface{}) error {
+	return ce.cw.Write([]string{v.(string), strconv.Itoa(len(v.(string)))})
+}
+
+func (ce *testCSVEncoder) Close() error {
+	ce.cw.Flush()
+	return ce.w.Close()
+}
+
+type testFailingEncoder struct{}
+
+func (testFailingEncoder) Encode(v interface{}) error { return errors.New("encoding failed") }
+
+func (testFailingEncoder) Close() error { return nil }
+
+func TestConsumeMulti(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"cc", "a", "bbb", "dddd"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	var text, csvOut bytes.Buffer
+	err = sort.ConsumeMulti(
+		newTestLineEncoder(nopWriteCloser{&text}),
+		testFailingEncoder{},
+		&testCSVEncoder{w: nopWriteCloser{&csvOut}, cw: csv.NewWriter(&csvOut)},
+	)
+	if err == nil || !strings.Contains(err.Error(), "encoder 1: ") {
+		t.Errorf("expected error from encoder 1, but got %v", err)
+	}
+	if exp := "a\nbbb\ncc\ndddd\n"; text.String() != exp {
+		t.Errorf("expected text output %q but got %q", exp, text.String())
+	}
+	if exp := "a,1\nbbb,3\ncc,2\ndddd,4\n"; csvOut.String() != exp {
+		t.Errorf("expected csv output %q but got %q", exp, csvOut.String())
+	}
+}
+
+func TestSortToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesorttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input")
+	var data []byte
+	for i := 0; i < 10; i++ {
+		data = append(data, fmt.Sprintf("%d\n", (i*3)%10)...)
+	}
+	if err := ioutil.WriteFile(input, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := filepath.Join(dir, "temp")
+	if err := os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range []string{"", filepath.Join(dir, "sorted")} {
+		path, err := SortToFile(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithTempDir(tempDir),
+			WithInputFile(input),
+			WithOutputFile(output),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != "" && path != output {
+			t.Errorf("expected output in %s, but got %s", output, path)
+		}
+		if output == "" && filepath.Dir(path) != tempDir {
+			t.Errorf("expected output in %s, but got %s", tempDir, path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if output == "" {
+			os.Remove(path)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n"; string(data) != exp {
+			t.Errorf("expected %q but got %q", exp, data)
+		}
+		// the temporary files of the sort have been removed
+		if files, _ := ioutil.ReadDir(tempDir); len(files) != 0 {
+			t.Errorf("expected the temporary directory to be empty, but it contains %d files", len(files))
+		}
+	}
+	if _, err := SortToFile(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder)); err == nil {
+		t.Error("expected an error without the input file")
+	}
+	_, err = SortToFile(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithInputFile(filepath.Join(dir, "missing")),
+	)
+	if err == nil {
+		t.Error("expected an error for a missing input file")
+	}
+}
+
+func TestSortToFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesorttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(input, []byte("f\ne\nd\nc\nbad\na\nh\ng\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := filepath.Join(dir, "temp")
+	if err := os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "sorted")
+	for _, out := range []string{"", output} {
+		// the first decoder reads the input, where "bad" is fine, but it
+		// can't be read from the spill file, so the merge fails
+		inputOpened := false
+		path, err := SortToFile(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(func(r io.Reader) Decoder {
+				if !inputOpened {
+					inputOpened = true
+					return newTestLineDecoder(r)
+				}
+				return testBadLineDecoder{newTestLineDecoder(r)}
+			}),
+			WithMaxMemoryBuffer(3),
+			WithTempDir(tempDir),
+			WithInputFile(input),
+			WithOutputFile(out),
+		)
+		if err == nil || !strings.Contains(err.Error(), "bad line") {
+			t.Errorf("%q: expected decoding error, but got %v", out, err)
+		}
+		if path != "" {
+			t.Errorf("%q: expected no output path, but got %s", out, path)
+		}
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Errorf("%q: expected no output file, but got %v", out, err)
+		}
+		if files, _ := ioutil.ReadDir(tempDir); len(files) != 0 {
+			t.Errorf("%q: expected the temporary directory to be empty, but it contains %d files", out, len(files))
+		}
+	}
+}
+
+func TestPipeTo(t *testing.T) {
+	// records are "<major><minor>", the first pass sorts by the minor key
+	// and the second one by the major key
+	byMinor, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[1] < b.(string)[1] }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byMajor, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[0] < b.(string)[0] }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for major := 'a'; major <= 'd'; major++ {
+		for minor := '0'; minor <= '4'; minor++ {
+			expected = append(expected, string([]rune{major, minor}))
+		}
+	}
+	for i := range expected {
+		byMinor.Write(expected[(i*7)%len(expected)])
+	}
+	byMinor.Close()
+	if err := byMinor.PipeTo(byMajor); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range expected {
+		s, err := byMajor.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != exp {
+			t.Errorf("expected %s but got %v", exp, s)
+		}
+	}
+}
+
+func TestPipeToError(t *testing.T) {
+	src, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(func(r io.Reader) Decoder { return testBadLineDecoder{newTestLineDecoder(r)} }),
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the spill file with "bad" fails to be read in the middle of the merge
+	for _, s := range []string{"f", "e", "d", "c", "bad", "a", "h", "g"} {
+		src.Write(s)
+	}
+	src.Close()
+	if err := src.PipeTo(dst); err == nil || !strings.Contains(err.Error(), "bad line") {
+		t.Fatalf("expected decoding error from PipeTo, but got %v", err)
+	}
+	for {
+		v, err := dst.Read()
+		if err != nil {
+			if !strings.Contains(err.Error(), "bad line") {
+				t.Errorf("expected decoding error from the destination, but got %v", err)
+			}
+			break
+		}
+		if v == nil {
+			t.Fatal("expected an error, but the destination output has ended")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package filesort
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(func(r io.Reader) Decoder {
+			return &testSlowDecoder{newTestLineDecoder(r), 20 * time.Millisecond}
+		}),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithContext(ctx),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		sort.Write(fmt.Sprintf("%02d", 29-i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := sort.tempDir
+	// the consumer abandons the sort after reading a few records
+	for i := 0; i < 5; i++ {
+		if _, err := sort.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+	select {
+	case <-sort.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sort hasn't stopped after the context has been cancelled")
+	}
+	if err := sort.Err(); err != context.Canceled {
+		t.Errorf("expected context.Canceled from Err, but got %v", err)
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("expected temporary directory %s to be removed, but got %v", tempDir, err)
+	}
+	if err := sort.Write("00"); err != context.Canceled {
+		t.Errorf("expected context.Canceled from Write, but got %v", err)
+	}
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			if err != context.Canceled {
+				t.Errorf("expected context.Canceled from Read, but got %v", err)
+			}
+			break
+		}
+		if v == nil {
+			t.Fatal("expected context.Canceled from Read, but got EOF")
+		}
+	}
+}
+
+func TestContextAfterError(t *testing.T) {
+	for _, deadline := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if deadline {
+			ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		}
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithNoSpill(),
+			WithMaxMemoryBuffer(2),
+			WithContext(ctx),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the third record fails the sort before the context is done
+		for i := 0; i < 5; i++ {
+			sort.Write(fmt.Sprint(i))
+		}
+		for sort.Err() == nil {
+			time.Sleep(time.Millisecond)
+		}
+		first := sort.Err()
+		if !deadline {
+			cancel()
+		}
+		<-ctx.Done()
+		for !sort.aborted() {
+			time.Sleep(time.Millisecond)
+		}
+		// Abort returns once the abort by the context is complete
+		sort.Abort()
+		// the context error doesn't replace the error the sort failed with
+		if err := sort.Err(); err != first {
+			t.Errorf("expected %v, but got %v", first, err)
+		}
+		if v, err := sort.Read(); err != first {
+			t.Errorf("expected %v, but got %v %v", first, v, err)
+		}
+		cancel()
+	}
+}
@@ -4,13 +4,16 @@ package csv
 import (
 	"encoding/csv"
 	"io"
+	"strconv"
+	"strings"
 
 	filesort "gitlab.com/shaydo/go-filesort"
 )
 
 type csvEncoder struct {
-	w  io.Closer
-	cw *csv.Writer
+	w      io.Closer
+	cw     *csv.Writer
+	fields int
 }
 
 // NewEncoder returns filesort.Encoder that encodes slices of strings as CSV
@@ -20,7 +23,11 @@ func NewEncoder(w io.WriteCloser) filesort.Encoder {
 }
 
 func (ce *csvEncoder) Encode(row interface{}) error {
-	return ce.cw.Write(row.([]string))
+	r := row.([]string)
+	if err := checkFields(r, ce.fields); err != nil {
+		return err
+	}
+	return ce.cw.Write(r)
 }
 
 func (ce *csvEncoder) Close() error {
@@ -33,14 +40,16 @@ func (ce *csvEncoder) Close() error {
 }
 
 type csvDecoder struct {
-	r *csv.Reader
+	r      *csv.Reader
+	fields int
 }
 
-// NewDecoder returns filesort.Decoder that reads CSV encoded slices of strings
+// NewDecoder returns filesort.Decoder that reads CSV encoded slices of
+// strings. Records may have different numbers of fields.
 func NewDecoder(r io.Reader) filesort.Decoder {
 	c := csv.NewReader(r)
 	c.FieldsPerRecord = -1
-	return &csvDecoder{r: csv.NewReader(r)}
+	return &csvDecoder{r: c}
 }
 
 func (cd *csvDecoder) Decode() (interface{}, error) {
@@ -48,5 +57,67 @@ func (cd *csvDecoder) Decode() (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := checkFields(s, cd.fields); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
+
+// Column describes a column used for ordering records by ByColumns.
+type Column struct {
+	// Index is the index of the field in the record
+	Index int
+	// Compare returns a negative number if a should come before b, a
+	// positive number if b should come before a and 0 if they are equal. If
+	// it is nil, fields are compared with strings.Compare.
+	Compare func(a, b string) int
+}
+
+// ByColumns returns a comparison function that orders records by the given
+// columns in priority order, every column using its own comparator, so for
+// example one column can be compared numerically and another one using
+// locale-aware collation. Records that don't have some field are treated as
+// if it was empty.
+func ByColumns(columns ...Column) filesort.Less {
+	return func(a, b interface{}) bool {
+		ra, rb := a.([]string), b.([]string)
+		for _, col := range columns {
+			fa, fb := field(ra, col.Index), field(rb, col.Index)
+			compare := col.Compare
+			if compare == nil {
+				compare = strings.Compare
+			}
+			if c := compare(fa, fb); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}
+}
+
+func field(record []string, i int) string {
+	if i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+// CompareNumeric compares fields as floating point numbers. Fields that
+// aren't numbers come after the numbers and are compared as strings.
+func CompareNumeric(a, b string) int {
+	na, erra := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	nb, errb := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	switch {
+	case erra != nil && errb != nil:
+		return strings.Compare(a, b)
+	case erra != nil:
+		return 1
+	case errb != nil:
+		return -1
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package csv
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -107,3 +108,128 @@ func TestCSVSort(t *testing.T) {
 		t.Errorf("expected EOF, but got: %v %v", s, err)
 	}
 }
+
+func TestByColumns(t *testing.T) {
+	// a simple collation that ignores case and accents of a few letters
+	fold := strings.NewReplacer("é", "e", "É", "e", "ö", "o", "Ö", "o")
+	collate := func(a, b string) int {
+		return strings.Compare(fold.Replace(strings.ToLower(a)), fold.Replace(strings.ToLower(b)))
+	}
+	sort, err := filesort.New(
+		filesort.WithLess(ByColumns(Column{Index: 1, Compare: CompareNumeric}, Column{Index: 0, Compare: collate})),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][]string{
+		{"zoe", "10"},
+		{"Émile", "9"},
+		{"Ötzi", "10"},
+		{"adam", "9"},
+		{"eve", "9"},
+		{"bob", "100"},
+		{"n/a"},
+	} {
+		sort.Write(r)
+	}
+	sort.Close()
+	for _, exp := range []string{"adam,9", "Émile,9", "eve,9", "Ötzi,10", "zoe,10", "bob,100", "n/a"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := strings.Join(v.([]string), ","); res != exp {
+			t.Errorf("expected %s but got %s", exp, res)
+		}
+	}
+}
+
+func TestExpectedFields(t *testing.T) {
+	sort, err := filesort.New(
+		filesort.WithLess(ByColumns(Column{Index: 0})),
+		filesort.WithEncoderNew(NewEncoderFunc(WithExpectedFields(3))),
+		filesort.WithDecoderNew(NewDecoderFunc(WithExpectedFields(3))),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Write([]string{"c", "1", "x"})
+	sort.Write([]string{"a", "2"})
+	sort.Write([]string{"b", "3", "y"})
+	sort.Close()
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			if !strings.Contains(err.Error(), `expected 3 fields, but record ["a" "2"] has 2`) {
+				t.Errorf("expected schema error, but got %v", err)
+			}
+			break
+		}
+		if v == nil {
+			t.Fatal("expected schema error, but got EOF")
+		}
+	}
+
+	// records that fit the schema are sorted as usual
+	sort, err = filesort.New(
+		filesort.WithLess(ByColumns(Column{Index: 0})),
+		filesort.WithEncoderNew(NewEncoderFunc(WithExpectedFields(2))),
+		filesort.WithDecoderNew(NewDecoderFunc(WithExpectedFields(2))),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][]string{{"c", "1"}, {"a", "2"}, {"b", "3"}} {
+		sort.Write(r)
+	}
+	sort.Close()
+	for _, exp := range []string{"a", "b", "c"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.([]string)[0] != exp {
+			t.Errorf("expected %s but got %v", exp, v)
+		}
+	}
+}
+
+func TestVariableFields(t *testing.T) {
+	sort, err := filesort.New(
+		filesort.WithLess(ByColumns(Column{Index: 0})),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := [][]string{
+		{"d", "1", "2", "3"},
+		{"b"},
+		{"e", "x"},
+		{"a", "1", "2"},
+		{"c", "", "", "", ""},
+	}
+	for _, r := range input {
+		sort.Write(r)
+	}
+	sort.Close()
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, input[i]) {
+			t.Errorf("expected %q but got %q", input[i], v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+}
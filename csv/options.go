@@ -0,0 +1,64 @@
+package csv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// Option configures encoders and decoders returned by NewEncoderFunc and
+// NewDecoderFunc.
+type Option func(o *options)
+
+type options struct {
+	fields int
+}
+
+// WithExpectedFields makes encoders and decoders check that every record has
+// exactly n fields and fail with an error showing the record otherwise.
+func WithExpectedFields(n int) Option {
+	return func(o *options) {
+		o.fields = n
+	}
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewEncoderFunc returns a function creating encoders like NewEncoder, but
+// configured with the given options, which can be passed to
+// filesort.WithEncoderNew.
+func NewEncoderFunc(opts ...Option) func(w io.WriteCloser) filesort.Encoder {
+	o := newOptions(opts)
+	return func(w io.WriteCloser) filesort.Encoder {
+		return &csvEncoder{w: w, cw: csv.NewWriter(w), fields: o.fields}
+	}
+}
+
+// NewDecoderFunc returns a function creating decoders like NewDecoder, but
+// configured with the given options, which can be passed to
+// filesort.WithDecoderNew.
+func NewDecoderFunc(opts ...Option) func(r io.Reader) filesort.Decoder {
+	o := newOptions(opts)
+	return func(r io.Reader) filesort.Decoder {
+		c := csv.NewReader(r)
+		c.FieldsPerRecord = -1
+		return &csvDecoder{r: c, fields: o.fields}
+	}
+}
+
+// checkFields returns an error if fields is positive and the record doesn't
+// have exactly that many fields.
+func checkFields(record []string, fields int) error {
+	if fields > 0 && len(record) != fields {
+		return fmt.Errorf("expected %d fields, but record %q has %d", fields, record, len(record))
+	}
+	return nil
+}
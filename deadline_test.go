@@ -0,0 +1,81 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(func(r io.Reader) Decoder {
+			return &testSlowDecoder{newTestLineDecoder(r), 20 * time.Millisecond}
+		}),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithDeadline(time.Now().Add(100*time.Millisecond)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		sort.Write(fmt.Sprintf("%02d", 29-i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tempDir := sort.tempDir
+	var n int
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			if err != ErrDeadlineExceeded {
+				t.Errorf("expected ErrDeadlineExceeded, but got %v", err)
+			}
+			break
+		}
+		if v == nil {
+			t.Fatal("expected ErrDeadlineExceeded, but got EOF")
+		}
+		n++
+	}
+	if n == 30 {
+		t.Error("expected the output to be cut short")
+	}
+	if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
+		t.Errorf("expected temporary directory %s to be removed, but got %v", tempDir, err)
+	}
+	if err := sort.Write("00"); err != ErrDeadlineExceeded {
+		t.Errorf("expected ErrDeadlineExceeded from Write, but got %v", err)
+	}
+}
+
+func TestDeadlineNotExceeded(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithDeadline(time.Now().Add(time.Minute)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(9 - i))
+	}
+	sort.Close()
+	for i := 0; i < 10; i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != fmt.Sprint(i) {
+			t.Errorf("expected %d but got %v", i, v)
+		}
+	}
+}
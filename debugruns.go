@@ -0,0 +1,48 @@
+package filesort
+
+// RunBoundary is returned by Read between the records of two consecutive runs
+// if FileSort was created with WithDebugRunOutput.
+type RunBoundary struct {
+	// Run is the index of the run whose records follow
+	Run int
+}
+
+// WithDebugRunOutput makes FileSort output the records of every run, that is
+// of every spill file and of the memory buffer, consecutively in the order
+// of the runs instead of merging them, with RunBoundary returned by Read
+// between the runs. Records come out sorted within every run only. It's
+// meant for looking at how records were partitioned across runs when
+// debugging the merge. It can't be used with WithOutputReverse,
+// WithMonotonicKeys and WithWatermark.
+func WithDebugRunOutput() Option {
+	return func(ps *FileSort) {
+		ps.debugRunOutput = true
+	}
+}
+
+// emitRuns outputs the records of the readers one reader after another, with
+// RunBoundary between them.
+func (ps *FileSort) emitRuns(readers []Reader) error {
+	for run, r := range readers {
+		if run > 0 {
+			select {
+			case ps.out <- output{value: RunBoundary{Run: run}, run: run}:
+			case <-ps.abort:
+				return ErrAborted
+			}
+		}
+		for {
+			v, err := r.Next()
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				break
+			}
+			if err := ps.emit(v, run); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package filesort
+
+import "testing"
+
+func TestDebugRunOutput(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithDebugRunOutput(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"c", "a", "h", "f", "e", "b", "g", "d"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	// two spill files and the memory buffer
+	exp := []interface{}{"a", "c", "h", RunBoundary{Run: 1}, "b", "e", "f", RunBoundary{Run: 2}, "d", "g"}
+	for _, e := range exp {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != e {
+			t.Errorf("expected %v but got %v", e, v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+	if _, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithDebugRunOutput(),
+		WithOutputReverse(),
+	); err == nil {
+		t.Error("expected an error for debug run output with reverse output")
+	}
+}
@@ -0,0 +1,59 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// DecodeErrorPolicy specifies what FileSort does when a record can't be
+// decoded from a spill file.
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorAbort stops the sort with the error, which is returned by
+	// Read. This is the default.
+	DecodeErrorAbort DecodeErrorPolicy = iota
+	// DecodeErrorSkipRecord skips the record and continues with the next
+	// record of the file. The Decoder must be able to continue after an
+	// error, if it fails maxDecodeErrors times in a row, the rest of the file
+	// is skipped.
+	DecodeErrorSkipRecord
+	// DecodeErrorSkipFile skips the rest of the file.
+	DecodeErrorSkipFile
+)
+
+// maxDecodeErrors is the number of consecutive decoding errors after which
+// DecodeErrorSkipRecord gives up on the file.
+const maxDecodeErrors = 100
+
+// handleDecodeError handles the decoding error according to the policy. It
+// returns the next record if the error has been skipped, or nil if the rest
+// of the file has been skipped.
+func (fr *fileReader) handleDecodeError(err error) (interface{}, error) {
+	for n := 1; ; n++ {
+		switch {
+		case fr.policy == DecodeErrorSkipRecord && n < maxDecodeErrors:
+			fr.skipped(fmt.Errorf("skipped a record that couldn't be decoded: %v", err))
+		case fr.policy == DecodeErrorSkipRecord || fr.policy == DecodeErrorSkipFile:
+			fr.skipped(fmt.Errorf("skipped the rest of a spill file after decoding error: %v", err))
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("error while decoding a record: %v", err)
+		}
+		res, err2 := fr.dec.Decode()
+		if err2 == nil || err2 == io.EOF {
+			return res, nil
+		}
+		err = err2
+	}
+}
+
+// decodeErrorSkipped counts the skipped decoding error and passes it to the
+// callback set with WithDecodeErrorCallback.
+func (ps *FileSort) decodeErrorSkipped(err error) {
+	atomic.AddInt64(&ps.stats.DecodeErrorsSkipped, 1)
+	if ps.decodeErrorCallback != nil {
+		ps.decodeErrorCallback(err)
+	}
+}
@@ -0,0 +1,98 @@
+package filesort
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testBadLineDecoder fails to decode lines starting with "bad".
+type testBadLineDecoder struct {
+	Decoder
+}
+
+func (bd testBadLineDecoder) Decode() (interface{}, error) {
+	v, err := bd.Decoder.Decode()
+	if s, ok := v.(string); ok && strings.HasPrefix(s, "bad") {
+		return nil, errors.New("bad line")
+	}
+	return v, err
+}
+
+func TestDecodeErrorPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   DecodeErrorPolicy
+		expected []string
+		// skipped is the error passed to the callback
+		skipped string
+	}{
+		{"abort", DecodeErrorAbort, nil, ""},
+		{"skip record", DecodeErrorSkipRecord, []string{"a", "bbd", "c", "d", "e", "f", "g"}, "skipped a record"},
+		{"skip file", DecodeErrorSkipFile, []string{"a", "d", "e", "f", "g"}, "skipped the rest of a spill file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, index := range []bool{false, true} {
+				var skipped []error
+				opts := []Option{
+					WithLess(testLessLine),
+					WithEncoderNew(newTestLineEncoder),
+					WithDecoderNew(func(r io.Reader) Decoder { return testBadLineDecoder{newTestLineDecoder(r)} }),
+					WithMaxMemoryBuffer(4),
+					WithDecodeErrorPolicy(tc.policy),
+					WithDecodeErrorCallback(func(err error) { skipped = append(skipped, err) }),
+				}
+				if index {
+					opts = append(opts, WithIndex())
+				}
+				sort, err := New(opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// the first spill file is "a", "bad", "bbd", "c", the second
+				// one is "d", "e", "f", "g"
+				for _, s := range []string{"c", "bad", "a", "bbd", "g", "e", "f", "d"} {
+					sort.Write(s)
+				}
+				sort.Close()
+				var res []string
+				for {
+					v, err := sort.Read()
+					if err != nil {
+						if tc.expected != nil {
+							t.Fatal(err)
+						}
+						if !strings.Contains(err.Error(), "bad line") {
+							t.Errorf("expected decoding error, but got %v", err)
+						}
+						break
+					}
+					if v == nil {
+						if tc.expected == nil {
+							t.Fatal("expected an error, but got EOF")
+						}
+						break
+					}
+					if index {
+						v = v.(IndexedRecord).Value
+					}
+					res = append(res, v.(string))
+				}
+				if tc.expected != nil && strings.Join(res, ",") != strings.Join(tc.expected, ",") {
+					t.Errorf("index %v: expected %v but got %v", index, tc.expected, res)
+				}
+				if tc.skipped == "" {
+					if len(skipped) != 0 {
+						t.Errorf("index %v: expected no skipped errors, but got %v", index, skipped)
+					}
+				} else if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), tc.skipped) || !strings.Contains(skipped[0].Error(), "bad line") {
+					t.Errorf("index %v: expected an error containing %q, but got %v", index, tc.skipped, skipped)
+				}
+				if n := sort.Stats().DecodeErrorsSkipped; n != int64(len(skipped)) {
+					t.Errorf("index %v: expected %d decoding errors skipped in stats, but got %d", index, len(skipped), n)
+				}
+			}
+		})
+	}
+}
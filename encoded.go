@@ -0,0 +1,115 @@
+package filesort
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// encodedRecord is a record together with its encoded form used for
+// comparison by FileSort created with WithEncodedComparison. Records read
+// from spill files have only the encoded form and value is nil.
+type encodedRecord struct {
+	data  []byte
+	value interface{}
+}
+
+func lessEncoded(a, b interface{}) bool {
+	return bytes.Compare(a.(encodedRecord).data, b.(encodedRecord).data) < 0
+}
+
+// encodeRecord encodes the record on its own with the configured Encoder.
+func (ps *FileSort) encodeRecord(v interface{}) (encodedRecord, error) {
+	var buf bytes.Buffer
+	enc := ps.newEncoder(nopWriteCloser{&buf})
+	if err := enc.Encode(v); err != nil {
+		return encodedRecord{}, fmt.Errorf("couldn't encode a value: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return encodedRecord{}, fmt.Errorf("error when closing encoder: %v", err)
+	}
+	return encodedRecord{data: buf.Bytes(), value: v}, nil
+}
+
+// decodeRecord returns the record with the encoded form replaced by the
+// value, decoding it with the configured Decoder if needed.
+func (ps *FileSort) decodeRecord(v interface{}) (interface{}, error) {
+	if ir, ok := v.(IndexedRecord); ok {
+		var err error
+		ir.Value, err = ps.decodeRecord(ir.Value)
+		return ir, err
+	}
+	er := v.(encodedRecord)
+	if er.value != nil {
+		return er.value, nil
+	}
+	res, err := ps.newDecoder(bytes.NewReader(er.data)).Decode()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error while decoding a record: %v", err)
+	}
+	if res == nil {
+		return nil, fmt.Errorf("couldn't decode a record from %q", er.data)
+	}
+	return res, nil
+}
+
+// encodedEncoder writes encoded forms of the records into spill files, each
+// prefixed with its length.
+type encodedEncoder struct {
+	w  io.WriteCloser
+	bw *bufio.Writer
+}
+
+func newEncodedEncoder(w io.WriteCloser) *encodedEncoder {
+	return &encodedEncoder{w: w, bw: bufio.NewWriter(w)}
+}
+
+func (ee *encodedEncoder) Encode(v interface{}) error {
+	data := v.(encodedRecord).data
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(data)))
+	if _, err := ee.bw.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := ee.bw.Write(data)
+	return err
+}
+
+func (ee *encodedEncoder) Close() error {
+	if err := ee.bw.Flush(); err != nil {
+		ee.w.Close()
+		return err
+	}
+	return ee.w.Close()
+}
+
+// encodedDecoder reads encoded forms of the records written by
+// encodedEncoder.
+type encodedDecoder struct {
+	r *bufio.Reader
+}
+
+func newEncodedDecoder(r io.Reader) *encodedDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &encodedDecoder{r: br}
+}
+
+func (ed *encodedDecoder) Decode() (interface{}, error) {
+	n, err := binary.ReadUvarint(ed.r)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(ed.r, data); err != nil {
+		return nil, err
+	}
+	return encodedRecord{data: data}, nil
+}
@@ -0,0 +1,103 @@
+package filesort
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// testIntEncoder writes int64 values as big-endian numbers with the sign bit
+// flipped, so the byte order matches the numeric order.
+type testIntEncoder struct {
+	w io.WriteCloser
+}
+
+func newTestIntEncoder(w io.WriteCloser) Encoder {
+	return &testIntEncoder{w: w}
+}
+
+func (ie *testIntEncoder) Encode(v interface{}) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v.(int64))^(1<<63))
+	_, err := ie.w.Write(buf[:])
+	return err
+}
+
+func (ie *testIntEncoder) Close() error {
+	return ie.w.Close()
+}
+
+type testIntDecoder struct {
+	r *bufio.Reader
+}
+
+func newTestIntDecoder(r io.Reader) Decoder {
+	return &testIntDecoder{r: bufio.NewReader(r)}
+}
+
+func (id *testIntDecoder) Decode() (interface{}, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(id.r, buf[:]); err != nil {
+		return nil, err
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]) ^ (1 << 63)), nil
+}
+
+func TestEncodedComparison(t *testing.T) {
+	sort, err := New(
+		WithEncoderNew(newTestIntEncoder),
+		WithDecoderNew(newTestIntDecoder),
+		WithMaxMemoryBuffer(4),
+		WithEncodedComparison(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []int64{300, -2, 7, 1 << 40, -1 << 40, 0, 255, 256, -1, 1, -300}
+	for _, v := range input {
+		sort.Write(v)
+	}
+	sort.Close()
+	expected := []int64{-1 << 40, -300, -2, -1, 0, 1, 7, 255, 256, 300, 1 << 40}
+	for _, exp := range expected {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %d but got %v", exp, v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected the end of the stream, but got %v %v", v, err)
+	}
+}
+
+func TestEncodedComparisonIndex(t *testing.T) {
+	sort, err := New(
+		WithEncoderNew(newTestIntEncoder),
+		WithDecoderNew(newTestIntDecoder),
+		WithMaxMemoryBuffer(2),
+		WithEncodedComparison(),
+		WithIndex(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []int64{5, -5, 3, 5, -5}
+	for _, v := range input {
+		sort.Write(v)
+	}
+	sort.Close()
+	expected := []IndexedRecord{{1, int64(-5)}, {4, int64(-5)}, {2, int64(3)}, {0, int64(5)}, {3, int64(5)}}
+	for _, exp := range expected {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %v but got %v", exp, v)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package filesort
+
+// updateExtremes updates the smallest and the largest records with v. Of
+// equal records the first one written is the smallest and the last one is the
+// largest, just like in the sorted output.
+func (ps *FileSort) updateExtremes(v interface{}) {
+	if ps.min == nil || ps.less(v, ps.min) {
+		ps.min = v
+	}
+	if ps.max == nil || !ps.less(v, ps.max) {
+		ps.max = v
+	}
+}
+
+// extreme waits till all the records have been written and returns v as it
+// would be returned by Read.
+func (ps *FileSort) extreme(v *interface{}) interface{} {
+	select {
+	case <-ps.ingested:
+	case <-ps.done:
+	}
+	if *v == nil {
+		return nil
+	}
+	res := *v
+	if ir, ok := res.(IndexedRecord); ok {
+		res = ir.Value
+	}
+	if er, ok := res.(encodedRecord); ok {
+		res = er.value
+	}
+	if kr, ok := res.(keyedRecord); ok {
+		res = kr.value
+	}
+	return res
+}
+
+// Min returns the smallest record written if FileSort was created with
+// WithTrackExtremes, or nil otherwise or if no records have been written. It
+// doesn't need reading the sorted output, but blocks till the input has been
+// closed and all the records have been processed. Records are returned
+// without index even with WithIndex.
+func (ps *FileSort) Min() interface{} {
+	return ps.extreme(&ps.min)
+}
+
+// Max returns the largest record written if FileSort was created with
+// WithTrackExtremes, see Min.
+func (ps *FileSort) Max() interface{} {
+	return ps.extreme(&ps.max)
+}
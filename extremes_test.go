@@ -0,0 +1,60 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTrackExtremes(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(4),
+		WithTrackExtremes(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		sort.Write(fmt.Sprintf("%02d", (i*11)%30+10))
+	}
+	sort.Close()
+	min, max := sort.Min(), sort.Max()
+	var first, last interface{}
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		if first == nil {
+			first = v
+		}
+		last = v
+	}
+	if min != first || max != last {
+		t.Errorf("expected min %v and max %v, but got %v and %v", first, last, min, max)
+	}
+	if min != "10" || max != "39" {
+		t.Errorf("expected min 10 and max 39, but got %v and %v", min, max)
+	}
+}
+
+func TestTrackExtremesEmpty(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithTrackExtremes(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Close()
+	if min, max := sort.Min(), sort.Max(); min != nil || max != nil {
+		t.Errorf("expected nil min and max, but got %v and %v", min, max)
+	}
+}
@@ -0,0 +1,106 @@
+package filesort
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// FieldOrder describes a field of struct records used for ordering them by
+// ByFields.
+type FieldOrder struct {
+	// Name is the name of the field, fields of embedded structs can be
+	// used by their names too
+	Name string
+	// Desc is true if the records with larger values of the field come
+	// first
+	Desc bool
+}
+
+// ByFields returns a comparison function that orders struct records, or
+// pointers to structs, by the given fields in priority order. Fields must be
+// of boolean, integer, floating point or string types. The indices of the
+// fields are looked up once for every type of records and cached. The
+// function panics if records don't have some of the fields or they are of
+// unsupported types, like type assertions in other comparison functions.
+func ByFields(fields ...FieldOrder) Less {
+	var indices sync.Map // reflect.Type -> [][]int
+	lookup := func(t reflect.Type) [][]int {
+		if idx, ok := indices.Load(t); ok {
+			return idx.([][]int)
+		}
+		idx := make([][]int, len(fields))
+		for i, f := range fields {
+			sf, ok := t.FieldByName(f.Name)
+			if !ok {
+				panic(fmt.Sprintf("filesort: type %v has no field %s", t, f.Name))
+			}
+			switch sf.Type.Kind() {
+			case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			default:
+				panic(fmt.Sprintf("filesort: field %s of type %v can't be compared", f.Name, sf.Type))
+			}
+			idx[i] = sf.Index
+		}
+		indices.Store(t, idx)
+		return idx
+	}
+	return func(a, b interface{}) bool {
+		va, vb := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+		ia, ib := lookup(va.Type()), lookup(vb.Type())
+		for i, f := range fields {
+			c := compareValues(va.FieldByIndex(ia[i]), vb.FieldByIndex(ib[i]))
+			if c != 0 {
+				return c < 0 != f.Desc
+			}
+		}
+		return false
+	}
+}
+
+// compareValues returns -1, 0 or 1 if a is less than, equal to or greater
+// than b, which are of the same kind.
+func compareValues(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Bool:
+		x, y := a.Bool(), b.Bool()
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Float32, reflect.Float64:
+		x, y := a.Float(), b.Float()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, y := a.Int(), b.Int()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	x, y := a.Uint(), b.Uint()
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package filesort
+
+import "testing"
+
+func TestByFields(t *testing.T) {
+	type person struct {
+		Name string
+		Age  int
+	}
+	sort, err := New(
+		WithLess(ByFields(FieldOrder{Name: "Age"}, FieldOrder{Name: "Name"})),
+		WithEncoderNew(newTestJSONEncoder),
+		WithDecoderNew(newTestPersonDecoder),
+		WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []testPerson{{"Dave", 30}, {"Carol", 25}, {"Alice", 30}, {"Bob", 25}, {"Eve", 20}}
+	for _, p := range input {
+		sort.Write(p)
+	}
+	sort.Close()
+	var res []testPerson
+	if err := sort.ReadAllInto(&res); err != nil {
+		t.Fatal(err)
+	}
+	exp := []testPerson{{"Eve", 20}, {"Bob", 25}, {"Carol", 25}, {"Alice", 30}, {"Dave", 30}}
+	if len(res) != len(exp) {
+		t.Fatalf("expected %v, but got %v", exp, res)
+	}
+	for i := range exp {
+		if res[i] != exp[i] {
+			t.Errorf("expected %v at %d, but got %v", exp[i], i, res[i])
+		}
+	}
+
+	// descending age, pointers to structs
+	less := ByFields(FieldOrder{Name: "Age", Desc: true}, FieldOrder{Name: "Name"})
+	a, b, c := &person{"Bob", 40}, &person{"Alice", 40}, &person{"Carol", 50}
+	if !less(c, a) || !less(b, a) || less(a, b) || less(a, c) {
+		t.Error("expected order Carol, Alice, Bob")
+	}
+}
@@ -3,14 +3,29 @@
 package filesort
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
-	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// ErrAborted is returned by FileSort methods after the sort has been aborted.
+var ErrAborted = errors.New("sort has been aborted")
+
+// ErrDeadlineExceeded is returned by FileSort methods after the sort has been
+// aborted because it hasn't completed by the deadline set with WithDeadline.
+var ErrDeadlineExceeded = errors.New("sort deadline exceeded")
+
 // Encoder is an interface that can encode records and write them out
 type Encoder interface {
 	// Encode encodes the argument and writes it out
@@ -19,25 +34,138 @@ type Encoder interface {
 	Close() error
 }
 
+// BatchEncoder is an Encoder that can also encode a number of records at
+// once. If the Encoder returned by the constructor passed to WithEncoderNew
+// implements this interface, FileSort uses EncodeBatch to write out the whole
+// memory buffer.
+type BatchEncoder interface {
+	Encoder
+	// EncodeBatch encodes all the records and writes them out
+	EncodeBatch(vs []interface{}) error
+}
+
 // Decoder is an interface that can decode records.
 type Decoder interface {
 	// Decode record
 	Decode() (interface{}, error)
 }
 
+// Less is a comparison function that returns true if a should come before b
+// in the sorted output. It is called from the goroutine that sorts the
+// records, so any state it uses, such as a lookup table, must not be modified
+// concurrently until the sort is done, see ByLookup for a safe alternative.
+type Less func(a, b interface{}) bool
+
 // FileSort represents a single sort pipe to which you first write all the
-// records, and then reading them sorted.
+// records, and then reading them sorted. Spill files are removed once they
+// have been merged, and the temporary directory is removed when the merge
+// ends. If the sort fails before the merge, the temporary files are kept till
+// Abort is called.
 type FileSort struct {
-	in         chan interface{}
-	out        chan interface{}
-	less       func(a, b interface{}) bool
-	buffer     []interface{}
-	bufferLen  int
-	bufferMax  int
-	files      []string
-	newEncoder func(w io.WriteCloser) Encoder
-	newDecoder func(r io.Reader) Decoder
-	err        atomic.Value
+	in               chan interface{}
+	out              chan output
+	less             func(a, b interface{}) bool
+	lessErr          func(a, b interface{}) (bool, error)
+	cmpErr           atomic.Value
+	buffer           []interface{}
+	bufferLen        int
+	bufferBytes      int64
+	mergeBytes       int64
+	peakBytes        int64
+	bufferMax        int
+	maxBytes         int64
+	sizeEstimate     int64
+	files            []string
+	spills           int
+	newEncoder       func(w io.WriteCloser) Encoder
+	newDecoder       func(r io.Reader) Decoder
+	noSpill          bool
+	keyCache         *keyCache
+	outputReverse    bool
+	recordTo         io.Writer
+	recorder         Encoder
+	rateLimiter      *rateLimiter
+	checksum         hash.Hash64
+	checksumEnc      Encoder
+	checksumSum      uint64
+	withIndex        bool
+	readerTimeout    time.Duration
+	inputFile        string
+	outputFile       string
+	keyed            bool
+	compactThreshold int
+	maxOpenFiles     int
+	profileLess      bool
+	hashTieBreak     bool
+	mergeReadAhead   int
+	parallelism      int
+	debugRunOutput   bool
+	batchLess        BatchLess
+	bufferReuse      bool
+	checkpoint       *mergeCheckpoint
+	spillJobs        []*spillJob
+	reverse          bool
+	pagerMu          sync.Mutex
+	pager            *pager
+	outputTransform  func(v interface{}) (interface{}, error)
+	// transitivitySample is the number of triples of records checked
+	transitivitySample  int
+	transitivityChecked bool
+	plainTextSpill      bool
+	compress            bool
+	compressLevel       int
+	spillWarning        func(spillNumber int)
+	encodedComparison   bool
+	adjacentEqual       func(a, b interface{}) bool
+	unique              bool
+	limit               int
+	isNull              func(v interface{}) bool
+	nullsFirst          bool
+	outCount            int
+	totalHint           int64
+	progressFn          func(percent float64)
+	lastProgress        float64
+	lastOut             interface{}
+	monotonic           bool
+	monotonicFailed     bool
+	watermark           *watermark
+	lateRecords         func(v interface{})
+	pending             []interface{}
+	emittedLast         interface{}
+	decodeErrorPolicy   DecodeErrorPolicy
+	decodeErrorCallback func(err error)
+	phaseCallback       func(phase Phase)
+	preKey              func(v interface{}) uint64
+	tempParent          string
+	store               ObjectStore
+	storeSeq            int
+	storeSizes          map[string]int64
+	storeMu             sync.Mutex
+	trackExtremes       bool
+	checkInversions     bool
+	maxInversions       int64
+	unread              []interface{}
+	pauseMu             sync.Mutex
+	resumed             chan struct{}
+	min, max            interface{}
+	stats               Stats
+	spillSizesMu        sync.Mutex
+	spillCount          int64
+	spillTotal          int64
+	prev                interface{}
+	seq                 int64
+	seed                int64
+	rand                *rand.Rand
+	tempDir             string
+	abort               chan struct{}
+	abortOnce           sync.Once
+	abortErr            error
+	deadline            time.Time
+	ctx                 context.Context
+	done                chan struct{}
+	ingested            chan struct{}
+	syncClose           bool
+	err                 atomic.Value
 }
 
 // Option represents various options for FileSort
@@ -50,6 +178,16 @@ func WithLess(less func(a, b interface{}) bool) Option {
 	}
 }
 
+// WithLessErr specifies comparison function that returns true if a should
+// come before b in the sorted output, or an error if the records can't be
+// compared. An error aborts the sort and is returned by Read. It can be used
+// instead of WithLess.
+func WithLessErr(less func(a, b interface{}) (bool, error)) Option {
+	return func(ps *FileSort) {
+		ps.lessErr = less
+	}
+}
+
 // WithEncoderNew specifies the funcion to create the Encoder
 func WithEncoderNew(ec func(w io.WriteCloser) Encoder) Option {
 	return func(ps *FileSort) {
@@ -66,87 +204,986 @@ func WithDecoderNew(dc func(r io.Reader) Decoder) Option {
 
 // WithMaxMemoryBuffer specifies the maximum number of records that can be held
 // in memory. When this limit has been reached the records are sorted and
-// flushed to temporary file on disk.
+// flushed to temporary file on disk. The size must be positive.
 func WithMaxMemoryBuffer(size int) Option {
 	return func(ps *FileSort) {
 		ps.bufferMax = size
 	}
 }
 
+// WithMaxMemoryBytes specifies the maximum approximate size in bytes of the
+// records held in memory. When it is set, the memory buffer is flushed to a
+// temporary file once the total size of the buffered records reaches the
+// limit, and WithMaxMemoryBuffer is ignored when accepting input. See
+// PeakBufferedBytes for how the size of records is computed.
+func WithMaxMemoryBytes(n int64) Option {
+	return func(ps *FileSort) {
+		ps.maxBytes = n
+	}
+}
+
+// WithRecordSizeEstimate specifies the size in bytes assumed for records of
+// types whose size isn't known, i.e. not implementing Sizer. The default is
+// 64 bytes.
+func WithRecordSizeEstimate(size int) Option {
+	return func(ps *FileSort) {
+		ps.sizeEstimate = int64(size)
+	}
+}
+
+// WithNoSpill forbids FileSort to flush records to disk. If the number of
+// records written exceeds the maximum memory buffer size, the sort fails
+// instead of spilling to a temporary file.
+func WithNoSpill() Option {
+	return func(ps *FileSort) {
+		ps.noSpill = true
+	}
+}
+
+// WithKeyCache makes FileSort compare keys returned by extract instead of
+// records themselves, so the function passed to WithLess receives keys. The
+// extracted keys for up to size recently compared records are cached, which
+// saves repeated extraction when the same records are compared many times
+// during merge. Records are identified by the address of their data for
+// slices, maps and pointers, and by value for other comparable types.
+// Records of other types are not cached. The cache holds the records whose
+// keys it keeps, so up to size records stay in memory after they have been
+// spilled or output.
+func WithKeyCache(size int, extract func(v interface{}) interface{}) Option {
+	return func(ps *FileSort) {
+		ps.keyCache = newKeyCache(size, extract)
+	}
+}
+
+// WithRandSeed specifies the seed for the random number generator used by any
+// randomized internal behavior, such as sampling, making it reproducible. By
+// default the generator is seeded with the current time.
+func WithRandSeed(seed int64) Option {
+	return func(ps *FileSort) {
+		ps.seed = seed
+	}
+}
+
+// WithOutputReverse makes FileSort output records in the reverse order, so the
+// output is exactly the reverse of what it would be without this option. If
+// records have been spilled to disk, the merged output is written to
+// temporary files once more and then read back from the last one to the
+// first, so this requires as much extra disk space as the data being sorted.
+func WithOutputReverse() Option {
+	return func(ps *FileSort) {
+		ps.outputReverse = true
+	}
+}
+
+// WithReverse makes FileSort sort records in descending order if reverse is
+// true, i.e. a comes before b if the comparison function returns true for b
+// and a, so comparison functions such as text.Less can be reused for
+// descending sorts. Unlike with WithOutputReverse, records that are equal
+// stay in the order they have been written, and no extra disk space is
+// needed.
+func WithReverse(reverse bool) Option {
+	return func(ps *FileSort) {
+		ps.reverse = reverse
+	}
+}
+
+// WithRecord makes FileSort write all the records it receives to w in the
+// order they have been written using the configured Encoder. The recorded
+// input can be replayed later with ReplayFrom to reproduce the sort.
+func WithRecord(w io.Writer) Option {
+	return func(ps *FileSort) {
+		ps.recordTo = w
+	}
+}
+
+// WithReadRateLimit limits the rate at which sorted records are output to
+// recordsPerSec, so a slow consumer doesn't get overwhelmed. Waiting for the
+// limiter is interrupted by Abort. A non-positive rate means no limit.
+func WithReadRateLimit(recordsPerSec int) Option {
+	return func(ps *FileSort) {
+		ps.rateLimiter = nil
+		if recordsPerSec > 0 {
+			ps.rateLimiter = newRateLimiter(recordsPerSec)
+		}
+	}
+}
+
+// WithOutputChecksum makes FileSort compute the checksum of the sorted output
+// encoded with the configured Encoder. The checksum can be retrieved using the
+// OutputChecksum method after the output has been read completely.
+func WithOutputChecksum() Option {
+	return func(ps *FileSort) {
+		ps.checksum = fnv.New64a()
+	}
+}
+
+// WithIndex makes FileSort return records as IndexedRecord values containing
+// the original records together with their positions in the input. Records
+// passed to the comparison function and the encoders are still the original
+// ones, the indices are stored separately.
+func WithIndex() Option {
+	return func(ps *FileSort) {
+		ps.withIndex = true
+	}
+}
+
+// WithReaderTimeout specifies the maximum time reading of a single record
+// from a spill file may take during merge. If the timeout is exceeded, the
+// spill file is closed to interrupt the read and the sort fails with an error
+// naming the stalled run. This is useful if spill files are backed by network
+// storage that may hang.
+func WithReaderTimeout(d time.Duration) Option {
+	return func(ps *FileSort) {
+		ps.readerTimeout = d
+	}
+}
+
+// WithInputFile specifies the path of the file SortToFile reads the records
+// to sort from.
+func WithInputFile(path string) Option {
+	return func(ps *FileSort) {
+		ps.inputFile = path
+	}
+}
+
+// WithOutputFile specifies the path of the file SortToFile writes sorted
+// records to.
+func WithOutputFile(path string) Option {
+	return func(ps *FileSort) {
+		ps.outputFile = path
+	}
+}
+
+// WithSyncClose makes Close wait till all the records have been sorted and
+// spilled to disk, so it can return errors that occurred while doing that.
+// By default Close returns immediately and errors are reported by Read.
+func WithSyncClose() Option {
+	return func(ps *FileSort) {
+		ps.syncClose = true
+	}
+}
+
+// WithCompactThreshold specifies the maximum number of spill files. When the
+// number of spill files exceeds n, some of the smaller adjacent files are
+// merged together into a single file, which makes the final merge more
+// efficient at the cost of extra disk I/O. By default files are not
+// compacted.
+func WithCompactThreshold(n int) Option {
+	return func(ps *FileSort) {
+		ps.compactThreshold = n
+	}
+}
+
+// WithMaxOpenFiles limits the number of spill files read at once during the
+// merge to n, which must be at least 2. If there are more spill files, they
+// are merged in passes, n files into one intermediate file, until no more
+// than n files are left for the final merge. This keeps the number of open
+// file descriptors bounded at the cost of extra disk I/O. Like with
+// WithCompactThreshold, spill files merged together count as one run for
+// ReadWithOrigin. By default all the spill files are read at once.
+func WithMaxOpenFiles(n int) Option {
+	return func(ps *FileSort) {
+		ps.maxOpenFiles = n
+	}
+}
+
+// WithComparatorProfile makes FileSort measure the time spent in the
+// comparison function, which is reported by Stats as ComparatorTime. It adds
+// the overhead of reading the clock twice per comparison.
+func WithComparatorProfile() Option {
+	return func(ps *FileSort) {
+		ps.profileLess = true
+	}
+}
+
+// WithOutputTransform specifies the function that is applied to every sorted
+// record before it is returned by Read. If the function returns an error, the
+// output stops and Read returns the error. The function must not return nil.
+func WithOutputTransform(fn func(v interface{}) (interface{}, error)) Option {
+	return func(ps *FileSort) {
+		ps.outputTransform = fn
+	}
+}
+
+// WithTransitivityCheck makes FileSort check that the comparison function is
+// transitive on sampleSize randomly chosen triples of records from the first
+// batch of records before sorting it. Both the order and the equality of
+// records, when neither comes before the other, must be transitive. If the
+// check fails, sorting stops with an error. Without transitivity the output
+// isn't sorted correctly.
+func WithTransitivityCheck(sampleSize int) Option {
+	return func(ps *FileSort) {
+		ps.transitivitySample = sampleSize
+	}
+}
+
+// WithPlainTextSpill guarantees that spill files contain nothing but the
+// output of the configured Encoder, without any compression or framing added
+// by FileSort. With a line based encoder, such as the one from the text
+// package, each spill file is then plain sorted text, so if a job has been
+// interrupted, the spill files can be merged with external tools, e.g.
+// "LC_ALL=C sort -m". Indices written with WithIndex are kept in separate
+// files and don't affect that. Records written with WriteWithKey can't be
+// sorted with this option.
+func WithPlainTextSpill() Option {
+	return func(ps *FileSort) {
+		ps.plainTextSpill = true
+	}
+}
+
+// WithSpillWarning specifies the function that is called every time the
+// memory buffer is spilled to disk, with the number of the spill starting from
+// 1. It is useful for alerting when a sort that is expected to fit into memory
+// doesn't, in which case it's enough to act on the first call. The function
+// is called from the sorting goroutine and must not block for long.
+func WithSpillWarning(fn func(spillNumber int)) Option {
+	return func(ps *FileSort) {
+		ps.spillWarning = fn
+	}
+}
+
+// WithEncodedComparison makes FileSort order records by comparing the bytes
+// produced by the configured Encoder for each of them with bytes.Compare
+// instead of using the comparison function, which then isn't required. This
+// is only correct if the encoding is order-preserving, i.e. the encoded form
+// of a record is lexicographically less than the one of another record if and
+// only if the first record should come first. Records are encoded once when
+// they are written and spill files keep the encoded forms, so the merge
+// compares them without decoding, and records are decoded only when they are
+// output. The encoded form of every record must be readable with the
+// configured Decoder on its own. The option can't be used together with
+// WithKeyCache, WithPlainTextSpill or WriteWithKey.
+func WithEncodedComparison() Option {
+	return func(ps *FileSort) {
+		ps.encodedComparison = true
+	}
+}
+
+// WithDeadline makes FileSort abort the sort if it hasn't completed by the
+// given time, i.e. if not all the sorted records have been passed to the
+// output by then. After that the methods return ErrDeadlineExceeded and the
+// temporary files are removed like after Abort.
+func WithDeadline(t time.Time) Option {
+	return func(ps *FileSort) {
+		ps.deadline = t
+	}
+}
+
+// WithContext makes FileSort abort the sort when the context is cancelled
+// before the sort has completed. After that the methods return the error of
+// the context, e.g. context.Canceled, and the temporary files are removed
+// like after Abort.
+func WithContext(ctx context.Context) Option {
+	return func(ps *FileSort) {
+		ps.ctx = ctx
+	}
+}
+
+// WithMaxInversions makes the sort fail if more than n records written are
+// less than the records written right before them, see Stats.Inversions. It
+// is a data quality guard for input that is expected to be nearly sorted,
+// e.g. if it has been sorted upstream.
+func WithMaxInversions(n int) Option {
+	return func(ps *FileSort) {
+		ps.checkInversions = true
+		ps.maxInversions = int64(n)
+	}
+}
+
+// WithAdjacentUnique makes FileSort skip output records that are equal to the
+// record output right before them according to equal, like uniq does, so only
+// the first record of every group of adjacent equal records is output. Unlike
+// the comparison function, equal may be coarser than the sort order, e.g.
+// compare only a part of the sort key.
+func WithAdjacentUnique(equal func(a, b interface{}) bool) Option {
+	return func(ps *FileSort) {
+		ps.adjacentEqual = equal
+	}
+}
+
+// WithMonotonicKeys makes FileSort start output before the input is closed,
+// assuming that the keys of the records are growing, so that every batch of
+// records that fills the memory buffer contains no records less than the ones
+// in the previous batches. A sorted batch is kept in memory till the next one
+// is complete, and if the smallest record of the next batch isn't less than
+// the largest record of the held batch, the held batch is output. Otherwise
+// the assumption doesn't hold and FileSort falls back to spilling and merging
+// all the rest of the records as usual. This requires memory for up to two
+// batches. If a record less than the records already output is written
+// later, it can't be placed anymore and the sort fails. ReadWithOrigin
+// reports run -1 for records output early. The output should be read
+// concurrently with writing, otherwise Write blocks once the output channel
+// is full. The option can't be used together with WithOutputReverse.
+func WithMonotonicKeys() Option {
+	return func(ps *FileSort) {
+		ps.monotonic = true
+	}
+}
+
+// WithDecodeErrorPolicy specifies what to do when a record can't be decoded
+// from a spill file, see DecodeErrorPolicy. By default the sort is aborted.
+func WithDecodeErrorPolicy(policy DecodeErrorPolicy) Option {
+	return func(ps *FileSort) {
+		ps.decodeErrorPolicy = policy
+	}
+}
+
+// WithDecodeErrorCallback specifies the function that is called with every
+// decoding error skipped according to the policy set with
+// WithDecodeErrorPolicy. The error tells whether the record or the rest of
+// the spill file has been skipped. The function is called from the sorting
+// goroutine and must not block for long.
+func WithDecodeErrorCallback(fn func(err error)) Option {
+	return func(ps *FileSort) {
+		ps.decodeErrorCallback = fn
+	}
+}
+
+// WithPhaseCallback specifies the function that is called when the sort
+// enters a new phase, see Phase. It is called from the sorting goroutine.
+func WithPhaseCallback(fn func(phase Phase)) Option {
+	return func(ps *FileSort) {
+		ps.phaseCallback = fn
+	}
+}
+
+// WithPreKey specifies a cheap function that maps records to numbers used to
+// avoid calling an expensive comparison function: records are compared by
+// their pre-keys first and the comparison function is called only if the
+// pre-keys are equal. For the order to be correct, the pre-key must be
+// monotonic with the comparison function, i.e. if a should come before b,
+// then cheap(a) <= cheap(b) must hold, for example the first bytes of a string
+// compared as a big-endian number. The function is called with the same
+// values as the comparison function, except that with WithKeyCache it gets
+// the records rather than the extracted keys.
+func WithPreKey(cheap func(v interface{}) uint64) Option {
+	return func(ps *FileSort) {
+		ps.preKey = cheap
+	}
+}
+
+// WithTempDir specifies the directory in which FileSort creates its
+// temporary directory for spill files. The directory must exist and be
+// writable, otherwise New returns an error. By default the system temporary
+// directory is used.
+func WithTempDir(dir string) Option {
+	return func(ps *FileSort) {
+		ps.tempParent = dir
+	}
+}
+
+// WithTrackExtremes makes FileSort track the smallest and the largest records
+// written, which are returned by Min and Max.
+func WithTrackExtremes() Option {
+	return func(ps *FileSort) {
+		ps.trackExtremes = true
+	}
+}
+
 // New creates a new FileSort object based on specified options
 func New(opts ...Option) (*FileSort, error) {
 	ps := &FileSort{
-		in:        make(chan interface{}, 4096),
-		out:       make(chan interface{}, 4096),
-		bufferMax: 1048576,
+		in:           make(chan interface{}, 4096),
+		out:          make(chan output, 4096),
+		abort:        make(chan struct{}),
+		done:         make(chan struct{}),
+		ingested:     make(chan struct{}),
+		bufferMax:    1048576,
+		sizeEstimate: defaultRecordSize,
+		seed:         time.Now().UnixNano(),
 	}
 	for _, o := range opts {
 		o(ps)
 	}
-	if ps.less == nil || ps.newDecoder == nil || ps.newEncoder == nil {
+	ps.rand = rand.New(rand.NewSource(ps.seed))
+	if lessErr := ps.lessErr; lessErr != nil {
+		ps.less = func(a, b interface{}) bool {
+			if ps.compareErr() != nil {
+				return false
+			}
+			res, err := lessErr(a, b)
+			if err != nil {
+				ps.setCompareErr(fmt.Errorf("couldn't compare records: %v", err))
+			}
+			return res
+		}
+	}
+	if ps.less == nil && !ps.encodedComparison || ps.newDecoder == nil || ps.newEncoder == nil {
 		return nil, fmt.Errorf("less, decoder and encoder constructors are required")
 	}
-	go ps.sort()
+	if ps.isNull != nil {
+		if ps.less == nil {
+			return nil, fmt.Errorf("nulls ordering can't be used with encoded comparison")
+		}
+		ps.less = lessNulls(ps.less, ps.isNull, ps.nullsFirst != ps.reverse)
+	}
+	if ps.unique && ps.adjacentEqual == nil {
+		less := ps.less
+		if less == nil {
+			return nil, fmt.Errorf("unique output requires either equality or comparison function")
+		}
+		ps.adjacentEqual = func(a, b interface{}) bool { return !less(a, b) && !less(b, a) }
+	}
+	if ps.encodedComparison && (ps.keyCache != nil || ps.plainTextSpill) {
+		return nil, fmt.Errorf("encoded comparison can't be used with key cache or plain text spill")
+	}
+	if ps.profileLess && ps.less != nil {
+		less := ps.less
+		ps.less = func(a, b interface{}) bool {
+			start := time.Now()
+			res := less(a, b)
+			atomic.AddInt64((*int64)(&ps.stats.ComparatorTime), int64(time.Since(start)))
+			return res
+		}
+	}
+	if ps.bufferMax <= 0 {
+		return nil, fmt.Errorf("memory buffer size must be positive, but it's %d", ps.bufferMax)
+	}
+	if ps.maxOpenFiles == 1 {
+		return nil, fmt.Errorf("maximum number of open files must be at least 2")
+	}
+	if err := ps.checkCompression(); err != nil {
+		return nil, err
+	}
+	if ps.monotonic && ps.outputReverse {
+		return nil, fmt.Errorf("monotonic keys can't be used with reverse output")
+	}
+	if ps.limit > 0 && ps.outputReverse {
+		return nil, fmt.Errorf("limit can't be used with reverse output, use WithReverse instead")
+	}
+	if ps.watermark != nil && (ps.monotonic || ps.outputReverse) {
+		return nil, fmt.Errorf("watermark can't be used with monotonic keys or reverse output")
+	}
+	if ps.checkpoint != nil && (ps.withIndex || ps.encodedComparison || ps.outputReverse || ps.debugRunOutput) {
+		return nil, fmt.Errorf("merge checkpoint can't be used with index, encoded comparison, reverse output or debug run output")
+	}
+	if ps.batchLess != nil && (ps.reverse || ps.isNull != nil || ps.hashTieBreak || ps.encodedComparison) {
+		return nil, fmt.Errorf("batch comparison can't be used with reverse order, nulls ordering, hash tie break or encoded comparison")
+	}
+	if ps.debugRunOutput && (ps.outputReverse || ps.monotonic || ps.watermark != nil) {
+		return nil, fmt.Errorf("debug run output can't be used with reverse output, monotonic keys or watermark")
+	}
+	if ps.tempParent != "" {
+		if err := checkTempDir(ps.tempParent); err != nil {
+			return nil, err
+		}
+	}
+	if ps.checksum != nil {
+		ps.checksumEnc = ps.newEncoder(nopWriteCloser{ps.checksum})
+	}
+	if ps.recordTo != nil {
+		ps.recorder = ps.newEncoder(nopWriteCloser{ps.recordTo})
+	}
+	if kc := ps.keyCache; kc != nil {
+		less := ps.less
+		ps.less = func(a, b interface{}) bool { return less(kc.key(a), kc.key(b)) }
+	}
+	if preKey := ps.preKey; preKey != nil && ps.less != nil {
+		less := ps.less
+		ps.less = func(a, b interface{}) bool {
+			ka, kb := preKey(a), preKey(b)
+			if ka != kb {
+				return ka < kb
+			}
+			return less(a, b)
+		}
+	}
+	less := ps.less
+	ps.less = func(a, b interface{}) bool {
+		if ps.keyed {
+			return less(a.(keyedRecord).key, b.(keyedRecord).key)
+		}
+		return less(a, b)
+	}
+	if ps.hashTieBreak {
+		ps.less = ps.lessTieBreak(ps.less)
+	}
+	if ps.encodedComparison {
+		ps.less = lessEncoded
+	}
+	if ps.reverse {
+		less := ps.less
+		ps.less = func(a, b interface{}) bool { return less(b, a) }
+	}
+	if ps.withIndex {
+		less := ps.less
+		ps.less = func(a, b interface{}) bool { return less(a.(IndexedRecord).Value, b.(IndexedRecord).Value) }
+	}
+	if ps.watermark != nil {
+		ps.watermark.less = ps.less
+	}
+	if ps.checkpoint != nil {
+		if err := ps.loadCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	ps.start()
 	return ps, nil
 }
 
+// start starts the sorting goroutine and the goroutines aborting it.
+func (ps *FileSort) start() {
+	go ps.sort()
+	if !ps.deadline.IsZero() {
+		go ps.watchDeadline()
+	}
+	if ps.ctx != nil {
+		go ps.watchContext()
+	}
+}
+
 func (ps *FileSort) sort() {
-	tempDir, err := ioutil.TempDir("", "filesort")
+	defer close(ps.done)
+	var tempDir string
+	var err error
+	if ps.store != nil {
+		tempDir, err = newStorePrefix()
+		ps.storeSizes = make(map[string]int64)
+	} else if tempDir, err = ioutil.TempDir(ps.tempParent, "filesort"); err != nil {
+		err = fmt.Errorf("couldn't create temporary directory: %v", err)
+	}
 	if err != nil {
-		ps.err.Store(fmt.Errorf("couldn't create temporary directory: %v", err))
+		// report the error to the readers right away and discard the
+		// records written till the input is closed
+		ps.setErr(err)
+		close(ps.out)
+		ps.drainInput()
+		close(ps.ingested)
+		return
 	}
-	for v := range ps.in {
+	ps.tempDir = tempDir
+	ps.phase(Ingesting)
+	for {
+		var v interface{}
+		var ok bool
+		if resumed := ps.pausedChan(); resumed != nil {
+			select {
+			case <-resumed:
+			case <-ps.abort:
+			}
+		}
+		select {
+		case v, ok = <-ps.in:
+		case <-ps.abort:
+			ps.waitSpills()
+			ps.removeTemp()
+			if err == nil {
+				ps.setErr(ps.abortErr)
+			}
+			close(ps.out)
+			return
+		}
+		if !ok {
+			break
+		}
 		// if there was en error just drain the channel
 		if err != nil {
 			continue
 		}
-		ps.buffer = append(ps.buffer, v)
-		ps.bufferLen++
-		if ps.bufferLen >= ps.bufferMax {
-			sort.SliceStable(ps.buffer, func(i, j int) bool { return ps.less(ps.buffer[i], ps.buffer[j]) })
-			err = ps.flushBuffer(tempDir)
-			if err != nil {
-				ps.err.Store(err)
+		if err = ps.add(v); err != nil {
+			if err == ErrAborted {
+				err = ps.abortErr
 			}
+			ps.setErr(err)
+		}
+	}
+	if err == nil {
+		if err = ps.finishInput(); err != nil {
+			ps.setErr(err)
 		}
+	} else {
+		ps.waitSpills()
 	}
+	if err != nil {
+		// remove the spill files before Close returns the error
+		ps.removeTemp()
+	}
+	close(ps.ingested)
 	if err != nil {
 		close(ps.out)
 		return
 	}
-	sort.SliceStable(ps.buffer, func(i, j int) bool { return ps.less(ps.buffer[i], ps.buffer[j]) })
-	if err := ps.merge(); err != nil {
-		ps.err.Store(err)
+	ps.phase(Merging)
+	err = ps.merge()
+	if err == nil {
+		err = ps.finishOutput()
+	}
+	ps.removeTemp()
+	if err == nil {
+		ps.phase(Done)
+	}
+	if err != nil {
+		if err == ErrAborted {
+			err = ps.abortErr
+		}
+		ps.setErr(err)
+	}
+	close(ps.out)
+}
+
+// drainInput discards the records written till the input is closed or the
+// sort is aborted.
+func (ps *FileSort) drainInput() {
+	for {
+		select {
+		case _, ok := <-ps.in:
+			if !ok {
+				return
+			}
+		case <-ps.abort:
+			return
+		}
+	}
+}
+
+// add adds a new record to the memory buffer and flushes the buffer to disk if
+// it is full.
+func (ps *FileSort) add(v interface{}) error {
+	orig := v
+	kr, keyed := v.(keyedRecord)
+	if keyed {
+		orig = kr.value
+	}
+	if ps.stats.RecordsIn == 0 {
+		ps.keyed = keyed
+		if keyed && ps.recorder != nil {
+			return fmt.Errorf("records written with WriteWithKey can't be recorded")
+		}
+		if keyed && ps.plainTextSpill {
+			return fmt.Errorf("records written with WriteWithKey can't be spilled as plain text")
+		}
+		if keyed && ps.encodedComparison {
+			return fmt.Errorf("records written with WriteWithKey can't be compared in encoded form")
+		}
+		if keyed && ps.checkpoint != nil {
+			return fmt.Errorf("records written with WriteWithKey can't be used with merge checkpoint")
+		}
+	} else if keyed != ps.keyed {
+		return fmt.Errorf("records written with Write and WriteWithKey can't be mixed")
+	}
+	if ps.recorder != nil {
+		if err := ps.recorder.Encode(v); err != nil {
+			return fmt.Errorf("couldn't record a value: %v", err)
+		}
+	}
+	if ps.encodedComparison {
+		var err error
+		if v, err = ps.encodeRecord(v); err != nil {
+			return err
+		}
+	}
+	if ps.withIndex {
+		v = IndexedRecord{Index: ps.seq, Value: v}
+		ps.seq++
+	}
+	if ps.emittedLast != nil && ps.less(v, ps.emittedLast) {
+		return fmt.Errorf("record is less than the records that have already been output, keys aren't monotonic")
+	}
+	if ps.prev != nil && ps.less(v, ps.prev) {
+		n := atomic.AddInt64(&ps.stats.Inversions, 1)
+		if ps.checkInversions && n > ps.maxInversions {
+			return fmt.Errorf("input has more than %d inversions, it isn't nearly sorted", ps.maxInversions)
+		}
+	}
+	ps.prev = v
+	if ps.trackExtremes {
+		ps.updateExtremes(v)
+	}
+	ps.progress(0, atomic.AddInt64(&ps.stats.RecordsIn, 1))
+	if ps.watermark != nil {
+		return ps.addWatermark(orig, v)
+	}
+	size := recordSize(v, ps.sizeEstimate)
+	if ps.noSpill {
+		if ps.maxBytes > 0 && ps.bufferBytes+size > ps.maxBytes {
+			return fmt.Errorf("size of records exceeds memory limit of %d bytes and spilling is disabled", ps.maxBytes)
+		}
+		if ps.maxBytes <= 0 && ps.bufferLen >= ps.bufferMax {
+			return fmt.Errorf("number of records exceeds memory buffer size of %d and spilling is disabled", ps.bufferMax)
+		}
+	}
+	ps.buffer = append(ps.buffer, v)
+	ps.bufferLen++
+	ps.bufferBytes += size
+	ps.updatePeak(ps.bufferBytes)
+	ps.updateMaxBuffer()
+	if ps.bufferFull() && ps.canPrune() {
+		return ps.pruneBuffer()
+	}
+	if ps.bufferFull() && !ps.noSpill {
+		if ps.parallelism > 1 && !ps.monotonic {
+			return ps.spillParallel()
+		}
+		if err := ps.sortBuffer(); err != nil {
+			return err
+		}
+		if ps.monotonic && !ps.monotonicFailed {
+			return ps.emitMonotonic()
+		}
+		if err := ps.flushBuffer(ps.tempDir); err != nil {
+			return err
+		}
+		return ps.compact()
+	}
+	return nil
+}
+
+// bufferFull returns true if the memory buffer has reached the limit set by
+// WithMaxMemoryBytes or, if it isn't set, by WithMaxMemoryBuffer.
+func (ps *FileSort) bufferFull() bool {
+	if ps.maxBytes > 0 {
+		return ps.bufferBytes >= ps.maxBytes
 	}
+	return ps.bufferLen >= ps.bufferMax
+}
+
+// finishInput is called after all the records have been added and prepares
+// the memory buffer for merge.
+func (ps *FileSort) finishInput() error {
+	if err := ps.finishSpills(); err != nil {
+		return err
+	}
+	if ps.recorder != nil {
+		if err := ps.recorder.Close(); err != nil {
+			return fmt.Errorf("error when closing recorder: %v", err)
+		}
+	}
+	return ps.sortBuffer()
+}
+
+// finishOutput is called after all the sorted records have been emitted.
+func (ps *FileSort) finishOutput() error {
+	if ps.checksumEnc != nil {
+		if err := ps.checksumEnc.Close(); err != nil {
+			return fmt.Errorf("error when closing checksum encoder: %v", err)
+		}
+		ps.checksumSum = ps.checksum.Sum64()
+	}
+	return nil
+}
+
+// sortBuffer sorts records in the memory buffer and returns an error if some
+// records couldn't be compared.
+func (ps *FileSort) sortBuffer() error {
+	if err := ps.checkTransitivityOnce(); err != nil {
+		return err
+	}
+	return ps.sortRecords(ps.buffer)
+}
+
+// checkTransitivityOnce checks the transitivity of the comparison function
+// on the first full memory buffer if WithTransitivityCheck is set.
+func (ps *FileSort) checkTransitivityOnce() error {
+	if ps.transitivitySample > 0 && !ps.transitivityChecked {
+		ps.transitivityChecked = true
+		return ps.checkTransitivity(ps.buffer)
+	}
+	return nil
+}
+
+// compareErr returns the first error returned by the comparison function.
+// It is safe to call it from several goroutines.
+func (ps *FileSort) compareErr() error {
+	if v := ps.cmpErr.Load(); v != nil {
+		return v.(storedError).err
+	}
+	return nil
+}
+
+// setCompareErr records err unless some error has been recorded already.
+func (ps *FileSort) setCompareErr(err error) {
+	ps.cmpErr.CompareAndSwap(nil, storedError{err})
+}
+
+// storedError wraps errors stored in atomic.Value, which requires values of
+// the same type.
+type storedError struct {
+	err error
+}
+
+// setErr stores the error that has stopped the sort.
+func (ps *FileSort) setErr(err error) {
+	ps.err.Store(storedError{err})
 }
 
 func (ps *FileSort) flushBuffer(tempDir string) error {
-	file, err := ioutil.TempFile(tempDir, "i")
-	ps.files = append(ps.files, file.Name())
+	err := ps.spill(tempDir, ps.buffer)
+	ps.resetBuffer()
+	return err
+}
+
+// spill writes records into a new spill file in tempDir.
+func (ps *FileSort) spill(tempDir string, records []interface{}) error {
+	name, err := ps.writeRun(tempDir, records)
+	if name != "" {
+		ps.files = append(ps.files, name)
+	}
 	if err != nil {
-		return fmt.Errorf("couldn't create a temporary file: %v", err)
+		return err
+	}
+	return ps.spilled(name)
+}
+
+// spilled updates the statistics after the memory buffer has been written
+// into the spill file and calls the spill warning callback.
+func (ps *FileSort) spilled(name string) error {
+	size, err := ps.runSize(name)
+	if err != nil {
+		return fmt.Errorf("couldn't get the size of a spill file: %v", err)
+	}
+	ps.addSpillSize(size)
+	atomic.AddInt64(&ps.stats.BytesSpilled, size)
+	ps.spills++
+	if ps.spillWarning != nil {
+		ps.spillWarning(ps.spills)
 	}
-	enc := ps.newEncoder(file)
-	for _, v := range ps.buffer {
-		if err := enc.Encode(v); err != nil {
-			return fmt.Errorf("couldn't encode a value: %v", err)
+	return nil
+}
+
+// tmpSuffix is the suffix of spill files that are still being written.
+const tmpSuffix = ".tmp"
+
+// writeRun writes records into a new temporary file in tempDir and returns
+// its name.
+func (ps *FileSort) writeRun(tempDir string, records []interface{}) (string, error) {
+	return ps.writeRecords(tempDir, ps.runEncoder, records)
+}
+
+// encoderFunc returns the encoder writing records into w, which is the file
+// with the given name.
+type encoderFunc func(w io.WriteCloser, name string) (Encoder, error)
+
+// writeRecords writes records encoded by the encoder returned by newEnc into
+// a new temporary file in tempDir and returns its name.
+func (ps *FileSort) writeRecords(tempDir string, newEnc encoderFunc, records []interface{}) (string, error) {
+	return ps.writeFileFunc(tempDir, newEnc, func(enc Encoder) error {
+		if be, ok := enc.(BatchEncoder); ok {
+			if err := be.EncodeBatch(records); err != nil {
+				return fmt.Errorf("couldn't encode values: %v", err)
+			}
+			return nil
+		}
+		for _, v := range records {
+			if err := enc.Encode(v); err != nil {
+				return fmt.Errorf("couldn't encode a value: %v", err)
+			}
 		}
+		return nil
+	})
+}
+
+// writeRunFunc creates a new temporary file in tempDir, calls write to write
+// records into it and returns its name.
+func (ps *FileSort) writeRunFunc(tempDir string, write func(enc Encoder) error) (string, error) {
+	return ps.writeFileFunc(tempDir, ps.runEncoder, write)
+}
+
+// writeFileFunc creates a new temporary file in tempDir, calls write with the
+// encoder returned by newEnc to write records into it and returns its name.
+// Records are written into a file with tmpSuffix, which is renamed only after
+// the encoder has been closed successfully, so incomplete files never get the
+// final name. In case of error the name of the incomplete file is returned if
+// it has been created.
+func (ps *FileSort) writeFileFunc(tempDir string, newEnc encoderFunc, write func(enc Encoder) error) (string, error) {
+	if ps.store != nil {
+		return ps.writeObjectFunc(tempDir, newEnc, write)
+	}
+	file, err := ioutil.TempFile(tempDir, "i*"+tmpSuffix)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create a temporary file: %v", err)
+	}
+	tmpName := file.Name()
+	name := strings.TrimSuffix(tmpName, tmpSuffix)
+	if err := ps.writeEncoded(file, name, newEnc, write); err != nil {
+		return tmpName, err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		return tmpName, fmt.Errorf("couldn't rename a temporary file: %v", err)
+	}
+	return name, nil
+}
+
+// writeObjectFunc is like writeFileFunc, but writes records into a new object
+// of the ObjectStore, which doesn't need renaming.
+func (ps *FileSort) writeObjectFunc(prefix string, newEnc encoderFunc, write func(enc Encoder) error) (string, error) {
+	ps.storeMu.Lock()
+	ps.storeSeq++
+	name := fmt.Sprintf("%si%d", prefix, ps.storeSeq)
+	ps.storeMu.Unlock()
+	w, err := ps.store.Put(name)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create an object: %v", err)
+	}
+	var size int64
+	err = ps.writeEncoded(countingWriteCloser{w, &size}, name, newEnc, write)
+	ps.storeMu.Lock()
+	ps.storeSizes[name] = size
+	ps.storeMu.Unlock()
+	return name, err
+}
+
+// writeEncoded wraps w, which is the spill file with the given name, into the
+// encoder returned by newEnc and calls write with it.
+func (ps *FileSort) writeEncoded(w io.WriteCloser, name string, newEnc encoderFunc, write func(enc Encoder) error) error {
+	enc, err := newEnc(ps.compressWriter(w), name)
+	if err != nil {
+		return err
+	}
+	if err := write(enc); err != nil {
+		enc.Close()
+		return err
 	}
-	ps.buffer = nil
-	ps.bufferLen = 0
 	if err := enc.Close(); err != nil {
 		return fmt.Errorf("error when closing encoder: %v", err)
 	}
 	return nil
 }
 
-type reader interface {
+// runEncoder returns the encoder of the records in the internal
+// representation, which are written into spill files.
+func (ps *FileSort) runEncoder(w io.WriteCloser, name string) (Encoder, error) {
+	var enc Encoder
+	if ps.encodedComparison {
+		enc = newEncodedEncoder(w)
+	} else {
+		enc = ps.newEncoder(w)
+	}
+	if ps.keyed {
+		enc = keyedEncoder{enc}
+	}
+	if ps.withIndex {
+		ie, err := ps.newIndexEncoder(enc, name)
+		if err != nil {
+			enc.Close()
+			return nil, err
+		}
+		enc = ie
+	}
+	return enc, nil
+}
+
+// removeRun removes the spill file together with its index file if any.
+func (ps *FileSort) removeRun(name string) {
+	remove := os.Remove
+	if ps.store != nil {
+		remove = ps.store.Delete
+	}
+	remove(name)
+	if ps.withIndex {
+		remove(name + ".idx")
+	}
+}
+
+// Reader is an interface that returns records one by one.
+type Reader interface {
+	// Next returns the next record or nil in the end of the stream
 	Next() (interface{}, error)
 }
 
 type sliceReader struct {
 	n     int
 	slice []interface{}
+	run   int
 }
 
 func (sr *sliceReader) Next() (interface{}, error) {
@@ -160,163 +1197,658 @@ func (sr *sliceReader) Next() (interface{}, error) {
 }
 
 type fileReader struct {
-	file *os.File
+	file io.ReadCloser
 	dec  Decoder
+	// heads is the counter of the sizes of the current records of all the
+	// file readers and headSize is the contribution of this reader
+	heads    *int64
+	headSize int64
+	// estimate is the size assumed for records of unknown types
+	estimate int64
+	run      int
+	policy   DecodeErrorPolicy
+	// skipped is called with the decoding errors skipped according to the
+	// policy
+	skipped func(err error)
+	// remove, if not nil, removes the spill file after it has been read
+	remove func()
 }
 
-func (ps *FileSort) makeFileReader(name string) (*fileReader, error) {
-	file, err := os.Open(name)
+// makeFileReader opens the spill file for reading with a read-ahead buffer of
+// the given size, or without one if it's 0.
+func (ps *FileSort) makeFileReader(name string, readAhead int) (*fileReader, error) {
+	return ps.openFileReader(name, readAhead, ps.runDecoder)
+}
+
+// decoderFunc returns the decoder reading records from r, which is the
+// content of the file with the given name.
+type decoderFunc func(r io.Reader, name string) (Decoder, error)
+
+// openFileReader is like makeFileReader, but reads the file with the decoder
+// returned by newDec.
+func (ps *FileSort) openFileReader(name string, readAhead int, newDec decoderFunc) (*fileReader, error) {
+	file, err := ps.openRun(name)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = file
+	if readAhead > 0 {
+		r = bufio.NewReaderSize(file, readAhead)
+	}
+	r, err = ps.decompressReader(r)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	dec, err := newDec(r, name)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-	dec := ps.newDecoder(file)
 	return &fileReader{
-		file: file,
-		dec:  dec,
+		file:     file,
+		dec:      dec,
+		heads:    &ps.mergeBytes,
+		estimate: ps.sizeEstimate,
+		policy:   ps.decodeErrorPolicy,
+		skipped:  ps.decodeErrorSkipped,
 	}, nil
 }
 
+// runDecoder returns the decoder of the records in the internal
+// representation, which are read from spill files.
+func (ps *FileSort) runDecoder(r io.Reader, name string) (Decoder, error) {
+	var dec Decoder
+	if ps.encodedComparison {
+		dec = newEncodedDecoder(r)
+	} else {
+		dec = ps.newDecoder(r)
+	}
+	if ps.keyed {
+		dec = keyedDecoder{dec}
+	}
+	if ps.withIndex {
+		id, err := ps.newIndexDecoder(dec, name)
+		if err != nil {
+			return nil, err
+		}
+		dec = id
+	}
+	return dec, nil
+}
+
+func (fr *fileReader) Close() error {
+	if fr.file == nil {
+		return nil
+	}
+	err := fr.file.Close()
+	fr.file = nil
+	if c, ok := fr.dec.(io.Closer); ok {
+		c.Close()
+	}
+	return err
+}
+
 func (fr *fileReader) Next() (interface{}, error) {
 	if fr.file == nil {
 		return nil, nil
 	}
 	res, err := fr.dec.Decode()
 	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("error while decoding a record: %v", err)
+		if res, err = fr.handleDecodeError(err); err != nil {
+			return nil, err
+		}
 	}
+	var size int64
 	if res == nil {
-		fr.file.Close()
-		fr.file = nil
+		fr.Close()
+		if fr.remove != nil {
+			fr.remove()
+			fr.remove = nil
+		}
+	} else {
+		size = recordSize(res, fr.estimate)
 	}
+	atomic.AddInt64(fr.heads, size-fr.headSize)
+	fr.headSize = size
 	return res, nil
 }
 
+// mergeReader merges the records of sorted readers using a loser tree.
 type mergeReader struct {
-	next func() (interface{}, error)
+	less func(a, b interface{}) bool
+	// heads are the current records of the readers, nil if the reader has
+	// ended, they are kept apart from the readers for the sake of locality
+	heads   []interface{}
+	readers []Reader
+	origins []int
+	// tree is the loser tree: tree[0] is the index of the head with the
+	// smallest record and the other nodes hold the losers of the matches
+	// played in them
+	tree []int
+	last int
 }
 
-func (mr *mergeReader) Next() (interface{}, error) {
-	return mr.next()
+// beats returns true if the head a comes before the head b. Heads of the
+// readers that have ended come after all the others, and equal records are
+// ordered by the index of their readers, which keeps the merge stable. It
+// takes at most a single call of less.
+func (mr *mergeReader) beats(a, b int) bool {
+	va, vb := mr.heads[a], mr.heads[b]
+	switch {
+	case va == nil || vb == nil:
+		return va != nil || vb == nil && a < b
+	case a < b:
+		return !mr.less(vb, va)
+	}
+	return mr.less(va, vb)
 }
 
-func newMergeReader(less func(a, b interface{}) bool, rs []reader) (reader, error) {
-	n := len(rs)
-	if n == 1 {
-		return rs[0], nil
+// build plays the matches in the subtree of the node p and returns the
+// winner. Heads are the leaves of the tree at nodes len(heads) and above.
+func (mr *mergeReader) build(p int) int {
+	k := len(mr.heads)
+	if p >= k {
+		return p - k
 	}
-	var rs0, rs1 reader
-	var err error
-	if n == 2 {
-		rs0 = rs[0]
-		rs1 = rs[1]
-	} else {
-		n = n / 2
-		if rs0, err = newMergeReader(less, rs[:n]); err != nil {
-			return nil, err
-		}
-		if rs1, err = newMergeReader(less, rs[n:]); err != nil {
-			return nil, err
-		}
-	}
-	n0, err := rs0.Next()
-	if err != nil {
-		return nil, err
+	a, b := mr.build(2*p), mr.build(2*p+1)
+	if mr.beats(a, b) {
+		mr.tree[p] = b
+		return a
 	}
-	if n0 == nil {
-		return rs1, nil
+	mr.tree[p] = a
+	return b
+}
+
+func (mr *mergeReader) Next() (interface{}, error) {
+	w := mr.tree[0]
+	res := mr.heads[w]
+	if res == nil {
+		return nil, nil
 	}
-	n1, err := rs1.Next()
+	mr.last = mr.origins[w]
+	r := mr.readers[w]
+	v, err := r.Next()
 	if err != nil {
 		return nil, err
 	}
-	next := func() (interface{}, error) {
-		var err error
-		if n0 == nil {
-			return nil, nil
-		}
-		if n1 == nil {
-			res := n0
-			if n0, err = rs0.Next(); err != nil {
-				return nil, err
-			}
-			return res, nil
+	mr.heads[w] = v
+	if v != nil {
+		mr.origins[w] = readerOrigin(r)
+	}
+	// replay the matches on the path from the leaf to the root, the
+	// winner's record is kept in v, and the loser of every match stays in
+	// the node
+	tree, heads, less := mr.tree, mr.heads, mr.less
+	for p := (w + len(heads)) >> 1; p > 0; p >>= 1 {
+		l := tree[p]
+		lv := heads[l]
+		if lv == nil {
+			continue
 		}
-		if !less(n1, n0) {
-			res := n0
-			if n0, err = rs0.Next(); err != nil {
-				return nil, err
+		if v != nil {
+			// the loser l wins if it's less than v, or if it's equal
+			// to v and comes from an earlier reader; the arguments are
+			// swapped rather than branched on to compare both ways
+			// with a single call
+			a, b, later := v, lv, l > w
+			if later {
+				a, b = lv, v
 			}
-			if n0 == nil {
-				n0 = n1
-				n1 = nil
-				rs0 = rs1
+			if less(a, b) != later {
+				continue
 			}
-			return res, nil
 		}
-		res := n1
-		if n1, err = rs1.Next(); err != nil {
+		tree[p], w, v = w, l, lv
+	}
+	tree[0] = w
+	return res, nil
+}
+
+// newMergeReader returns Reader that merges records from sorted readers using
+// a loser tree, so every record costs log2(n) comparisons. Records that are
+// equal according to less are returned in the order of the readers they come
+// from.
+func newMergeReader(less func(a, b interface{}) bool, rs []Reader) (Reader, error) {
+	if len(rs) == 0 {
+		return &sliceReader{}, nil
+	}
+	if len(rs) == 1 {
+		return rs[0], nil
+	}
+	mr := &mergeReader{
+		less:    less,
+		heads:   make([]interface{}, len(rs)),
+		readers: rs,
+		origins: make([]int, len(rs)),
+		tree:    make([]int, len(rs)),
+	}
+	for i, r := range rs {
+		v, err := r.Next()
+		if err != nil {
 			return nil, err
 		}
-		return res, nil
+		mr.heads[i], mr.origins[i] = v, readerOrigin(r)
 	}
-	return &mergeReader{next: next}, nil
+	mr.tree[0] = mr.build(1)
+	return mr, nil
+}
+
+// MergeSlices merges already sorted slices of records and returns Reader that
+// outputs them in the sorted order. Records that are equal according to less
+// are returned in the order of the slices they come from, and in the order
+// they are stored in the slice if they come from the same one.
+func MergeSlices(less Less, runs ...[]interface{}) Reader {
+	readers := make([]Reader, len(runs))
+	for i, run := range runs {
+		readers[i] = &sliceReader{slice: run, run: i}
+	}
+	// sliceReader never fails, so neither can the merge
+	mr, _ := newMergeReader(less, readers)
+	return mr
 }
 
 func (ps *FileSort) merge() error {
-	defer close(ps.out)
-	var readers []reader
-	for _, file := range ps.files {
-		fr, err := ps.makeFileReader(file)
+	if ps.watermark != nil {
+		return ps.flushWatermark()
+	}
+	if err := ps.reduceRuns(); err != nil {
+		return err
+	}
+	// readers must be ordered the same way the records were written, so
+	// spill files come first and the memory buffer comes last, this way
+	// stable merge preserves the insertion order for equal records
+	var readers []Reader
+	var wd *readWatchdog
+	if ps.readerTimeout > 0 {
+		wd = newReadWatchdog(ps.readerTimeout)
+		defer wd.stop()
+	}
+	readAhead := ps.readAheadSize(len(ps.files))
+	for i, file := range ps.files {
+		fr, err := ps.makeFileReader(file, readAhead)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("couldn't open a spill file: %v", err)
+		}
+		fr.run = i
+		name := file
+		fr.remove = func() { ps.removeRun(name) }
+		var r interface {
+			Reader
+			io.Closer
+		} = fr
+		if wd != nil {
+			r = &timeoutReader{
+				fr:   fr,
+				name: fmt.Sprintf("%d (%s)", i, file),
+				wd:   wd,
+				file: fr.file,
+			}
 		}
-		readers = append(readers, fr)
+		defer r.Close()
+		readers = append(readers, r)
+	}
+	run := len(ps.files)
+	if len(ps.pending) > 0 {
+		readers = append(readers, &sliceReader{slice: ps.pending, run: run})
+		run++
 	}
 	if len(ps.buffer) > 0 {
-		readers = append(readers, &sliceReader{slice: ps.buffer})
+		readers = append(readers, &sliceReader{slice: ps.buffer, run: run})
 	}
+	if ps.debugRunOutput {
+		return ps.emitRuns(readers)
+	}
+	atomic.AddInt64(&ps.stats.MergePasses, 1)
 	mr, err := newMergeReader(ps.less, readers)
 	if err != nil {
 		return err
 	}
+	if ps.outputReverse {
+		return ps.emitReverse(mr)
+	}
 	for {
-		next, err := mr.Next()
+		next, err := ps.nextMerged(mr)
 		if err != nil {
 			return err
 		}
 		if next == nil {
 			break
 		}
-		ps.out <- next
+		ps.updatePeak(ps.bufferBytes + atomic.LoadInt64(&ps.mergeBytes))
+		if err := ps.emit(next, readerOrigin(mr)); err != nil {
+			return err
+		}
+		if ps.limit > 0 && ps.outCount >= ps.limit {
+			break
+		}
 	}
 	return nil
 }
 
+// nextMerged returns the next record from the merge reader, checking for
+// comparison errors.
+func (ps *FileSort) nextMerged(mr Reader) (interface{}, error) {
+	next, err := mr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.compareErr(); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// WithUnique makes FileSort output only one record of every group of equal
+// records, like "sort -u". Records are equal according to eq, or, if eq is
+// nil, if neither of them is less than the other one according to the
+// comparison function. Duplicates are removed as the sorted records are
+// output, so they are removed across spill files as well, and the first
+// record of every group in the stable sort order is kept. It is the same as
+// WithAdjacentUnique with the equality function derived from the comparison
+// function by default, which only works for records written with Write.
+func WithUnique(eq func(a, b interface{}) bool) Option {
+	return func(ps *FileSort) {
+		ps.unique = true
+		ps.adjacentEqual = eq
+	}
+}
+
+// emit sends the record that came from the given run to the output channel.
+func (ps *FileSort) emit(v interface{}, run int) error {
+	if ps.encodedComparison {
+		var err error
+		if v, err = ps.decodeRecord(v); err != nil {
+			return err
+		}
+	}
+	v = ps.outputValue(v)
+	if ps.adjacentEqual != nil {
+		value := v
+		if ps.withIndex {
+			value = v.(IndexedRecord).Value
+		}
+		if ps.lastOut != nil && ps.adjacentEqual(ps.lastOut, value) {
+			return nil
+		}
+		ps.lastOut = value
+	}
+	out := output{run: run}
+	if ps.checkpoint != nil {
+		var skip bool
+		if out.equal, skip = ps.checkpoint.emitted(v, ps.less); skip {
+			ps.outCount++
+			return nil
+		}
+		out.key = v
+	}
+	if ps.checksumEnc != nil {
+		value := v
+		if ps.withIndex {
+			value = v.(IndexedRecord).Value
+		}
+		if err := ps.checksumEnc.Encode(value); err != nil {
+			return fmt.Errorf("couldn't encode a value for checksum: %v", err)
+		}
+	}
+	if ps.outputTransform != nil {
+		var err error
+		if v, err = ps.outputTransform(v); err != nil {
+			return fmt.Errorf("couldn't transform a record: %v", err)
+		}
+		if v == nil {
+			return fmt.Errorf("output transform returned nil")
+		}
+	}
+	if ps.rateLimiter != nil {
+		if err := ps.rateLimiter.wait(ps.abort); err != nil {
+			return err
+		}
+	}
+	if ps.limit > 0 && ps.outCount >= ps.limit {
+		return nil
+	}
+	out.value = v
+	select {
+	case ps.out <- out:
+		ps.outCount++
+		ps.progress(50, int64(ps.outCount))
+		return nil
+	case <-ps.abort:
+		return ErrAborted
+	}
+}
+
 // Close closes input of the FileSort. After that you can start reading sorted
 // records using the Read method.
 func (ps *FileSort) Close() error {
 	close(ps.in)
+	if ps.syncClose {
+		select {
+		case <-ps.ingested:
+		case <-ps.done:
+		}
+		if err := ps.Err(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Write writes a record for sorting to FileSort.
+// Write writes a record for sorting to FileSort. It blocks while FileSort is
+// paused.
 func (ps *FileSort) Write(v interface{}) error {
-	if err := ps.err.Load(); err != nil {
-		return err.(error)
+	if err := ps.Err(); err != nil {
+		return err
+	}
+	if resumed := ps.pausedChan(); resumed != nil {
+		select {
+		case <-resumed:
+		case <-ps.done:
+			if err := ps.Err(); err != nil {
+				return err
+			}
+			return ErrAborted
+		}
+	}
+	select {
+	case ps.in <- v:
+	case <-ps.done:
+		if err := ps.Err(); err != nil {
+			return err
+		}
+		return ErrAborted
 	}
-	ps.in <- v
 	return nil
 }
 
+// OutputChecksum returns the FNV-1a checksum of the sorted output encoded with
+// the configured Encoder if FileSort was created with WithOutputChecksum. It
+// must be called after Read has returned the end of the stream.
+func (ps *FileSort) OutputChecksum() uint64 {
+	return ps.checksumSum
+}
+
+// ReplayFrom reads records recorded with WithRecord from r using the
+// configured Decoder and writes them to FileSort. It doesn't close the input,
+// so more records can be written after it.
+func (ps *FileSort) ReplayFrom(r io.Reader) error {
+	dec := ps.newDecoder(r)
+	for {
+		v, err := dec.Decode()
+		if err == io.EOF || (err == nil && v == nil) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error while decoding a record: %v", err)
+		}
+		if err := ps.Write(v); err != nil {
+			return err
+		}
+	}
+}
+
+// Abort stops the sort and removes all the temporary files. It waits till
+// the background goroutine exits, after that Write and Read return
+// ErrAborted, or the error the sort has already failed with. Abort can be
+// called at any point, including after the output has been read completely,
+// and it is safe to call it concurrently with other methods.
+func (ps *FileSort) Abort() {
+	ps.abortWith(ErrAborted)
+}
+
+// abortWith aborts the sort, so its methods return err afterwards, unless the
+// sort has already failed with another error, which is kept.
+func (ps *FileSort) abortWith(err error) {
+	ps.abortOnce.Do(func() {
+		ps.abortErr = err
+		close(ps.abort)
+		<-ps.done
+		if ps.Err() == nil {
+			ps.setErr(err)
+		}
+		for range ps.out {
+		}
+		ps.removeTemp()
+		ps.removePages()
+	})
+}
+
+// checkTempDir returns an error if dir isn't a writable directory.
+func checkTempDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("couldn't access temporary directory: %v", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("temporary directory %s is not a directory", dir)
+	}
+	file, err := ioutil.TempFile(dir, "filesort-check")
+	if err != nil {
+		return fmt.Errorf("temporary directory %s is not writable: %v", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// watchDeadline aborts the sort if it isn't done by the deadline.
+func (ps *FileSort) watchDeadline() {
+	timer := time.NewTimer(time.Until(ps.deadline))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		select {
+		case <-ps.done:
+		default:
+			ps.abortWith(ErrDeadlineExceeded)
+		}
+	case <-ps.done:
+	}
+}
+
+// watchContext aborts the sort if the context is cancelled before it's done.
+func (ps *FileSort) watchContext() {
+	select {
+	case <-ps.ctx.Done():
+		select {
+		case <-ps.done:
+		default:
+			ps.abortWith(ps.ctx.Err())
+		}
+	case <-ps.done:
+	}
+}
+
+// aborted returns true if Abort has been called.
+func (ps *FileSort) aborted() bool {
+	select {
+	case <-ps.abort:
+		return true
+	default:
+		return false
+	}
+}
+
 // Read returns the next sorted record or nil in the end of the stream. Note,
 // that if input hasn't been closed yet, the method will block till it will be
-// closed.
+// closed. An error that stops the sort is returned instead of the end of the
+// stream, records that have been sorted before the error may still be
+// returned first. Use Err to detect the failure without reading them. If
+// records may be nil, use ReadOK to detect the end of the stream.
 func (ps *FileSort) Read() (interface{}, error) {
-	val := <-ps.out
-	if val == nil {
-		if err := ps.err.Load(); err != nil {
-			return nil, err.(error)
+	val, _, err := ps.ReadWithOrigin()
+	return val, err
+}
+
+// Unread pushes the record back to the output, so that the next call to Read
+// returns it again. It can be used to retry processing of a record that has
+// been read. Several records can be pushed back, they are returned in the
+// reverse order, i.e. the last record pushed back is returned first. v must
+// not be nil. ReadWithOrigin returns run -1 for the records pushed back. Like
+// Read, Unread must not be called concurrently with other reading methods.
+func (ps *FileSort) Unread(v interface{}) {
+	ps.unread = append(ps.unread, v)
+}
+
+// Err returns the error that has stopped the sort, or nil if there was none
+// so far. It doesn't block and can be called at any time, e.g. after Close to
+// check for failures before reading the output.
+func (ps *FileSort) Err() error {
+	if v := ps.err.Load(); v != nil {
+		return v.(storedError).err
+	}
+	return nil
+}
+
+// ReadWithOrigin is like Read, but also returns the index of the run the
+// record came from during the merge. Spill files are numbered from 0 in the
+// order they were written, and the records that were still in the memory
+// buffer in the end of the input get the number following the last spill
+// file. Spill files merged early with WithCompactThreshold count as one run.
+// The run is -1 if it's unknown, which is the case with WithOutputReverse.
+func (ps *FileSort) ReadWithOrigin() (value interface{}, runIndex int, err error) {
+	out, ok, err := ps.readOutput()
+	if !ok {
+		return nil, -1, err
+	}
+	return out.value, out.run, nil
+}
+
+// ReadOK is like Read, but returns false in the end of the stream, so it can
+// be told apart from a nil record, such as the nil value of a record written
+// with WriteWithKey, which Read returns as nil too. Nil values can't be
+// spilled, so such records can only be sorted in memory.
+func (ps *FileSort) ReadOK() (value interface{}, ok bool, err error) {
+	out, ok, err := ps.readOutput()
+	return out.value, ok, err
+}
+
+// readOutput returns the next output record, or false in the end of the
+// stream.
+func (ps *FileSort) readOutput() (output, bool, error) {
+	if n := len(ps.unread); n > 0 {
+		v := ps.unread[n-1]
+		ps.unread = ps.unread[:n-1]
+		return output{value: v, run: -1}, true, nil
+	}
+	if ps.checkpoint != nil {
+		if err := ps.saveCheckpoint(); err != nil {
+			return output{}, false, err
 		}
 	}
-	return val, nil
+	val, ok := <-ps.out
+	if !ok {
+		if err := ps.Err(); err != nil {
+			return output{}, false, err
+		}
+		if ps.checkpoint != nil {
+			return output{}, false, ps.removeCheckpoint()
+		}
+		return output{}, false, nil
+	}
+	if ps.checkpoint != nil {
+		ps.checkpointRead(val)
+	}
+	return val, true, nil
 }
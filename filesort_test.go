@@ -2,8 +2,14 @@ package filesort
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -90,6 +96,15 @@ func TestSort(t *testing.T) {
 	}
 }
 
+func TestMaxMemoryBufferInvalid(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		_, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(size))
+		if err == nil || !strings.Contains(err.Error(), "must be positive") {
+			t.Errorf("expected an error for buffer size %d, but got %v", size, err)
+		}
+	}
+}
+
 func TestSortStable(t *testing.T) {
 	sort, err := New(
 		WithLess(func(a, b interface{}) bool { return false }),
@@ -115,3 +130,492 @@ func TestSortStable(t *testing.T) {
 		}
 	}
 }
+
+func TestSortNoSpill(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithNoSpill(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		sort.Write(fmt.Sprintf("%d", i))
+	}
+	sort.Close()
+	for {
+		s, err := sort.Read()
+		if err != nil {
+			break
+		}
+		if s == nil {
+			t.Fatal("expected an error when the buffer overflows, but got EOF")
+		}
+	}
+}
+
+func TestRandSeed(t *testing.T) {
+	// the comparison function makes a cycle of records from different
+	// classes, so checking a single random triple finds the violation only
+	// if it has records from all three classes, and the error names them
+	run := func(seed int64) string {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool {
+				x, _ := strconv.Atoi(a.(string))
+				y, _ := strconv.Atoi(b.(string))
+				return (y-x+3)%3 == 1
+			}),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithTransitivityCheck(1),
+			WithRandSeed(seed),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 30; i++ {
+			sort.Write(strconv.Itoa(i))
+		}
+		sort.Close()
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				return err.Error()
+			}
+			if v == nil {
+				return ""
+			}
+		}
+	}
+	outcomes := make(map[string]bool)
+	for seed := int64(1); seed <= 20; seed++ {
+		res := run(seed)
+		if again := run(seed); again != res {
+			t.Fatalf("seed %d: expected the same outcome, but got %q and %q", seed, res, again)
+		}
+		outcomes[res] = true
+	}
+	// the seed must actually drive the sampling
+	if len(outcomes) < 2 {
+		t.Errorf("expected different outcomes for different seeds, but got %v", outcomes)
+	}
+}
+
+func TestSortLessErr(t *testing.T) {
+	lessErr := func(a, b interface{}) (bool, error) {
+		for _, v := range []string{a.(string), b.(string)} {
+			if _, err := strconv.Atoi(v); err != nil {
+				return false, err
+			}
+		}
+		return testLessLine(a, b), nil
+	}
+	for _, malformed := range []int{2, 7} {
+		sort, err := New(WithLessErr(lessErr), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 8; i++ {
+			v := fmt.Sprintf("%d", 8-i)
+			if i == malformed {
+				v = "x"
+			}
+			sort.Write(v)
+		}
+		sort.Close()
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				if !strings.Contains(err.Error(), "couldn't compare records") {
+					t.Errorf("unexpected error: %v", err)
+				}
+				break
+			}
+			if v == nil {
+				t.Fatalf("expected comparison error for malformed record %d, but got EOF", malformed)
+			}
+		}
+	}
+}
+
+func TestMergeSlices(t *testing.T) {
+	type rec struct {
+		key int
+		tag string
+	}
+	less := func(a, b interface{}) bool { return a.(rec).key < b.(rec).key }
+	runs := [][]interface{}{
+		{rec{1, "a1"}, rec{3, "a3"}, rec{5, "a5"}, rec{5, "a5'"}},
+		{rec{2, "b2"}, rec{3, "b3"}, rec{6, "b6"}},
+		{},
+		{rec{0, "c0"}, rec{3, "c3"}, rec{5, "c5"}},
+	}
+	expected := []string{"c0", "a1", "b2", "a3", "b3", "c3", "a5", "a5'", "c5", "b6"}
+	mr := MergeSlices(less, runs...)
+	for _, exp := range expected {
+		v, err := mr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			t.Fatalf("unexpected end of output, expected %s", exp)
+		}
+		if got := v.(rec).tag; got != exp {
+			t.Errorf("expected %s but got %s", exp, got)
+		}
+	}
+	if v, err := mr.Next(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+	if v, err := MergeSlices(less).Next(); v != nil || err != nil {
+		t.Errorf("expected empty output when merging nothing, but got %v %v", v, err)
+	}
+}
+
+func TestSortStableAcrossSpill(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first four records are spilled to disk and the last two stay in memory
+	input := []string{"b1", "a2", "b3", "a4", "a5", "b6"}
+	for _, s := range input {
+		sort.Write(s)
+	}
+	sort.Close()
+	for _, exp := range []string{"a2", "a4", "a5", "b1", "b3", "b6"} {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.(string) != exp {
+			t.Errorf("expected %s but got %v", exp, s)
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	readAll := func(sort *FileSort) []string {
+		var res []string
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				return res
+			}
+			res = append(res, s.(string))
+		}
+	}
+	var rec bytes.Buffer
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3), WithRecord(&rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []string
+	for i := 0; i < 10; i++ {
+		input = append(input, fmt.Sprintf("%d", (i*7)%10))
+		sort.Write(input[i])
+	}
+	sort.Close()
+	expected := readAll(sort)
+	if exp := strings.Join(input, "\n") + "\n"; rec.String() != exp {
+		t.Errorf("expected recorded input %q but got %q", exp, rec.String())
+	}
+
+	sort, err = New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sort.ReplayFrom(&rec); err != nil {
+		t.Fatal(err)
+	}
+	sort.Close()
+	replayed := readAll(sort)
+	if strings.Join(replayed, ",") != strings.Join(expected, ",") {
+		t.Errorf("replayed output %v differs from the original %v", replayed, expected)
+	}
+}
+
+func TestOutputChecksum(t *testing.T) {
+	checksum := func(input []string) uint64 {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithOutputChecksum(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		return sort.OutputChecksum()
+	}
+	input := []string{"b1", "a2", "c3", "a4", "b5", "a6", "c7", "b8"}
+	first, second := checksum(input), checksum(input)
+	if first != second {
+		t.Errorf("checksums of two runs differ: %x != %x", first, second)
+	}
+	h := fnv.New64a()
+	io.WriteString(h, "a2\na4\na6\nb1\nb5\nb8\nc3\nc7\n")
+	if first != h.Sum64() {
+		t.Errorf("expected checksum %x but got %x", h.Sum64(), first)
+	}
+	input[0], input[4] = input[4], input[0]
+	if checksum(input) == first {
+		t.Error("expected checksum to change when the order of equal records changes")
+	}
+}
+
+type testFailingWriter struct {
+	io.WriteCloser
+}
+
+func (testFailingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk is full")
+}
+
+func TestSyncClose(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return newTestLineEncoder(testFailingWriter{w}) }),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		sort.Write(fmt.Sprintf("%d", i))
+	}
+	if err := sort.Close(); err == nil || !strings.Contains(err.Error(), "disk is full") {
+		t.Errorf("expected Close to return flush error, but got %v", err)
+	}
+
+	sort, err = New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3), WithSyncClose())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		sort.Write(fmt.Sprintf("%d", i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Errorf("expected no error from Close, but got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if s, err := sort.Read(); err != nil || s != fmt.Sprintf("%d", i) {
+			t.Errorf("expected %d but got %v %v", i, s, err)
+		}
+	}
+}
+
+func TestSpillTmpRename(t *testing.T) {
+	listDir := func(dir string) (complete, incomplete int) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if strings.HasSuffix(f.Name(), ".tmp") {
+				incomplete++
+			} else {
+				complete++
+			}
+		}
+		return
+	}
+	// the transform blocks the merge, so spill files aren't removed yet
+	unblock := make(chan struct{})
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithOutputTransform(func(v interface{}) (interface{}, error) {
+			<-unblock
+			return v, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprintf("%d", i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if complete, incomplete := listDir(sort.tempDir); complete != 3 || incomplete != 0 {
+		t.Errorf("expected 3 complete and no incomplete spill files, but got %d and %d", complete, incomplete)
+	}
+	close(unblock)
+	sort.Abort()
+
+	// the spill file has the temporary name while it's being written
+	var spilled string
+	sort, err = New(
+		WithLess(testLessLine),
+		WithEncoderNew(func(w io.WriteCloser) Encoder {
+			spilled = w.(*os.File).Name()
+			return newTestLineEncoder(testFailingWriter{w})
+		}),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		sort.Write(fmt.Sprintf("%d", i))
+	}
+	if err := sort.Close(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.HasSuffix(spilled, tmpSuffix) {
+		t.Errorf("expected the spill file to be written under a temporary name, but it's %s", spilled)
+	}
+	if _, err := os.Stat(spilled); !os.IsNotExist(err) {
+		t.Errorf("expected the incomplete spill file to be removed, but got %v", err)
+	}
+	sort.Abort()
+}
+
+func TestOutputTransform(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithOutputTransform(func(v interface{}) (interface{}, error) {
+			if v.(string) == "bad" {
+				return nil, errors.New("bad record")
+			}
+			return "#" + v.(string), nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"c", "a", "d", "b", "bad"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	for _, exp := range []string{"#a", "#b"} {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != exp {
+			t.Errorf("expected %s but got %v", exp, s)
+		}
+	}
+	if s, err := sort.Read(); err == nil || !strings.Contains(err.Error(), "bad record") {
+		t.Errorf("expected transform error, but got %v %v", s, err)
+	}
+}
+
+func TestErr(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return newTestLineEncoder(testFailingWriter{w}) }),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sort.Err(); err != nil {
+		t.Fatalf("expected no error before writing, but got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		sort.Write(fmt.Sprint(i))
+	}
+	sort.Close()
+	// wait till the sort stops
+	<-sort.done
+	err = sort.Err()
+	if err == nil {
+		t.Fatal("expected an error after the spill has failed")
+	}
+	if _, rerr := sort.Read(); rerr != err {
+		t.Errorf("expected Read to return %v, but got %v", err, rerr)
+	}
+
+	sort, err = New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Write("a")
+	sort.Close()
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+	}
+	if err := sort.Err(); err != nil {
+		t.Errorf("expected no error after successful sort, but got %v", err)
+	}
+}
+
+func TestUnread(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"c", "a", "b"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	read := func(exp interface{}) {
+		t.Helper()
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %v but got %v", exp, v)
+		}
+	}
+	read("a")
+	sort.Unread("a")
+	read("a")
+	read("b")
+	sort.Unread("b")
+	sort.Unread("a")
+	read("a")
+	read("b")
+	read("c")
+	read(nil)
+	sort.Unread("c")
+	read("c")
+	read(nil)
+}
@@ -1 +1,3 @@
 module gitlab.com/shaydo/go-filesort
+
+go 1.18
@@ -0,0 +1,61 @@
+// Package gob implements methods that enable filesort to sort arbitrary Go
+// values that are stored to disk using encoding/gob. Values are encoded as
+// interfaces, so the concrete types of the sorted values must be registered
+// with gob.Register from encoding/gob.
+package gob
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+type gobEncoder struct {
+	w   io.WriteCloser
+	bw  *bufio.Writer
+	enc *gob.Encoder
+}
+
+// NewEncoder returns filesort.Encoder that encodes values of registered types
+// with gob for storing into file.
+func NewEncoder(w io.WriteCloser) filesort.Encoder {
+	bw := bufio.NewWriter(w)
+	return &gobEncoder{w: w, bw: bw, enc: gob.NewEncoder(bw)}
+}
+
+func (ge *gobEncoder) Encode(v interface{}) error {
+	return ge.enc.Encode(&v)
+}
+
+func (ge *gobEncoder) Close() error {
+	if err := ge.bw.Flush(); err != nil {
+		ge.w.Close()
+		return err
+	}
+	return ge.w.Close()
+}
+
+type gobDecoder struct {
+	dec *gob.Decoder
+}
+
+// NewDecoder returns filesort.Decoder that reads values encoded by the
+// Encoder returned by NewEncoder. It returns nil and io.EOF in the end of the
+// stream. If r is a *bufio.Reader, the decoder reads from it directly instead
+// of adding a buffer of its own.
+func NewDecoder(r io.Reader) filesort.Decoder {
+	if _, ok := r.(*bufio.Reader); !ok {
+		r = bufio.NewReader(r)
+	}
+	return &gobDecoder{dec: gob.NewDecoder(r)}
+}
+
+func (gd *gobDecoder) Decode() (interface{}, error) {
+	var v interface{}
+	if err := gd.dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,83 @@
+package gob
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+type Person struct {
+	Name string
+	Age  int
+}
+
+func init() {
+	gob.Register(Person{})
+}
+
+func Example() {
+	sort, err := filesort.New(
+		filesort.WithLess(func(a, b interface{}) bool { return a.(Person).Age < b.(Person).Age }),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		panic(err)
+	}
+	people := []Person{{"Danny", 35}, {"Alice", 42}, {"Charly", 7}, {"Bob", 19}}
+	for _, p := range people {
+		sort.Write(p)
+	}
+	sort.Close()
+	for {
+		res, err := sort.Read()
+		if err != nil {
+			panic(err)
+		}
+		if res == nil {
+			// end of output
+			break
+		}
+		fmt.Println(res.(Person).Name, res.(Person).Age)
+	}
+	// Output:
+	// Charly 7
+	// Bob 19
+	// Danny 35
+	// Alice 42
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestGobDecoderEOF(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(nopCloser{&buf})
+	for i := 0; i < 3; i++ {
+		if err := enc.Encode(Person{fmt.Sprint("p", i), i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(&buf)
+	for i := 0; i < 3; i++ {
+		v, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := (Person{fmt.Sprint("p", i), i}); v != exp {
+			t.Errorf("expected %v but got %v", exp, v)
+		}
+	}
+	if v, err := dec.Decode(); v != nil || err != io.EOF {
+		t.Errorf("expected nil and io.EOF in the end of the stream, but got %v %v", v, err)
+	}
+}
@@ -0,0 +1,71 @@
+// Package grpcsort implements streaming of the output of filesort to gRPC
+// server streams. It doesn't depend on the gRPC package itself, instead it
+// uses the subset of the grpc.ServerStream interface it needs, which is
+// implemented by all the generated server streams.
+package grpcsort
+
+import (
+	"context"
+	"fmt"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// ServerStream is the part of grpc.ServerStream used by Send.
+type ServerStream interface {
+	// Context returns the context of the stream
+	Context() context.Context
+	// SendMsg sends a message to the client
+	SendMsg(m interface{}) error
+}
+
+// Send reads all the sorted records from fs and sends them to the stream in
+// order. If convert isn't nil, it is applied to every record to get the
+// message to send, otherwise records are sent as they are. If the context of
+// the stream is cancelled, the sort is aborted and the context error is
+// returned. If sending or converting fails, the sort is aborted as well, so
+// temporary files don't outlive the failed stream.
+func Send(stream ServerStream, fs *filesort.FileSort, convert func(v interface{}) (interface{}, error)) error {
+	ctx := stream.Context()
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			fs.Abort()
+		case <-finished:
+		}
+	}()
+	err := send(stream, fs, convert)
+	close(finished)
+	<-stopped
+	if ctx.Err() != nil {
+		fs.Abort()
+		return ctx.Err()
+	}
+	if err != nil {
+		fs.Abort()
+	}
+	return err
+}
+
+func send(stream ServerStream, fs *filesort.FileSort, convert func(v interface{}) (interface{}, error)) error {
+	for {
+		v, err := fs.Read()
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		if convert != nil {
+			if v, err = convert(v); err != nil {
+				return fmt.Errorf("couldn't convert a record: %v", err)
+			}
+		}
+		if err := stream.SendMsg(v); err != nil {
+			return fmt.Errorf("couldn't send a message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package grpcsort
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+	"gitlab.com/shaydo/go-filesort/text"
+)
+
+// testStream is an in-memory server stream that delivers messages to the
+// client through a channel.
+type testStream struct {
+	ctx context.Context
+	ch  chan interface{}
+}
+
+func (ts *testStream) Context() context.Context { return ts.ctx }
+
+func (ts *testStream) SendMsg(m interface{}) error {
+	select {
+	case ts.ch <- m:
+		return nil
+	case <-ts.ctx.Done():
+		return ts.ctx.Err()
+	}
+}
+
+func newTestSort(t *testing.T, n int) *filesort.FileSort {
+	fs, err := filesort.New(
+		filesort.WithLess(text.Less),
+		filesort.WithEncoderNew(text.NewEncoder),
+		filesort.WithDecoderNew(text.NewDecoder),
+		filesort.WithMaxMemoryBuffer(10),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		fs.Write(fmt.Sprintf("%03d", (i*37)%n))
+	}
+	fs.Close()
+	return fs
+}
+
+func TestSend(t *testing.T) {
+	fs := newTestSort(t, 100)
+	stream := &testStream{ctx: context.Background(), ch: make(chan interface{})}
+	res := make(chan error, 1)
+	go func() {
+		res <- Send(stream, fs, func(v interface{}) (interface{}, error) {
+			return "msg " + v.(string), nil
+		})
+		close(stream.ch)
+	}()
+	var n int
+	for m := range stream.ch {
+		if exp := fmt.Sprintf("msg %03d", n); m != exp {
+			t.Errorf("expected %s but got %v", exp, m)
+		}
+		n++
+	}
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Errorf("expected 100 messages but got %d", n)
+	}
+}
+
+func TestSendCancel(t *testing.T) {
+	fs := newTestSort(t, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &testStream{ctx: ctx, ch: make(chan interface{})}
+	res := make(chan error, 1)
+	go func() {
+		res <- Send(stream, fs, nil)
+	}()
+	for i := 0; i < 5; i++ {
+		<-stream.ch
+	}
+	cancel()
+	if err := <-res; err != context.Canceled {
+		t.Errorf("expected context.Canceled, but got %v", err)
+	}
+	if _, err := fs.Read(); err != filesort.ErrAborted {
+		t.Errorf("expected the sort to be aborted, but got %v", err)
+	}
+}
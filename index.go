@@ -0,0 +1,124 @@
+package filesort
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// IndexedRecord is a record together with its index in the input, records are
+// returned in this form by FileSort created with WithIndex option.
+type IndexedRecord struct {
+	// Index is the number of records written before this one
+	Index int64
+	// Value is the record itself
+	Value interface{}
+}
+
+// indexEncoder writes records using the configured Encoder and their indices
+// into a separate file, which gets its final name when the encoder is closed.
+// Objects in ObjectStore don't need renaming, so rename is false for them.
+type indexEncoder struct {
+	enc    Encoder
+	name   string
+	file   io.WriteCloser
+	w      *bufio.Writer
+	rename bool
+}
+
+func (ps *FileSort) newIndexEncoder(enc Encoder, name string) (*indexEncoder, error) {
+	name += ".idx"
+	if ps.store != nil {
+		w, err := ps.store.Put(name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create an index object: %v", err)
+		}
+		return &indexEncoder{enc: enc, name: name, file: w, w: bufio.NewWriter(w)}, nil
+	}
+	file, err := os.Create(name + tmpSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create an index file: %v", err)
+	}
+	return &indexEncoder{enc: enc, name: name, file: file, w: bufio.NewWriter(file), rename: true}, nil
+}
+
+func (ie *indexEncoder) Encode(v interface{}) error {
+	rec := v.(IndexedRecord)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(rec.Index))
+	if _, err := ie.w.Write(buf[:]); err != nil {
+		return err
+	}
+	return ie.enc.Encode(rec.Value)
+}
+
+func (ie *indexEncoder) Close() error {
+	err := ie.enc.Close()
+	if ferr := ie.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := ie.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && ie.rename {
+		err = os.Rename(ie.name+tmpSuffix, ie.name)
+	}
+	return err
+}
+
+// indexDecoder reads records using the configured Decoder and their indices
+// from a separate file.
+type indexDecoder struct {
+	dec  Decoder
+	file io.ReadCloser
+	r    *bufio.Reader
+}
+
+func (ps *FileSort) newIndexDecoder(dec Decoder, name string) (*indexDecoder, error) {
+	file, err := ps.openRun(name + ".idx")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open an index file: %v", err)
+	}
+	return &indexDecoder{dec: dec, file: file, r: bufio.NewReader(file)}, nil
+}
+
+func (id *indexDecoder) Decode() (interface{}, error) {
+	v, err := id.dec.Decode()
+	if err != nil && err != io.EOF {
+		// skip the index of the record, so the decoder can continue
+		var buf [8]byte
+		io.ReadFull(id.r, buf[:])
+		return nil, err
+	}
+	if err != nil || v == nil {
+		return v, err
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(id.r, buf[:]); err != nil {
+		return nil, fmt.Errorf("couldn't read an index: %v", err)
+	}
+	return IndexedRecord{Index: int64(binary.BigEndian.Uint64(buf[:])), Value: v}, nil
+}
+
+func (id *indexDecoder) Close() error {
+	return id.file.Close()
+}
+
+// Unsort takes records returned by FileSort created with WithIndex option and
+// returns their values in the original input order. The records slice itself
+// is not modified.
+func Unsort(records []IndexedRecord) []interface{} {
+	sorted := make([]IndexedRecord, len(records))
+	copy(sorted, records)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Index < sorted[j].Index
+	})
+	res := make([]interface{}, len(sorted))
+	for i, rec := range sorted {
+		res[i] = rec.Value
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+package filesort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type testRec struct {
+	key  int
+	name string
+}
+
+type testRecEncoder struct {
+	w  io.WriteCloser
+	bw *bufio.Writer
+}
+
+func newTestRecEncoder(w io.WriteCloser) Encoder {
+	return &testRecEncoder{w: w, bw: bufio.NewWriter(w)}
+}
+
+func (re *testRecEncoder) Encode(v interface{}) error {
+	r := v.(*testRec)
+	_, err := fmt.Fprintf(re.bw, "%d %s\n", r.key, r.name)
+	return err
+}
+
+func (re *testRecEncoder) Close() error {
+	if err := re.bw.Flush(); err != nil {
+		re.w.Close()
+		return err
+	}
+	return re.w.Close()
+}
+
+type testRecDecoder struct {
+	r *bufio.Reader
+}
+
+func newTestRecDecoder(r io.Reader) Decoder {
+	return &testRecDecoder{r: bufio.NewReader(r)}
+}
+
+func (rd *testRecDecoder) Decode() (interface{}, error) {
+	r := &testRec{}
+	if _, err := fmt.Fscanf(rd.r, "%d %s\n", &r.key, &r.name); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func TestIndexPointerRecords(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(*testRec).key < b.(*testRec).key }),
+		WithEncoderNew(newTestRecEncoder),
+		WithDecoderNew(newTestRecDecoder),
+		WithMaxMemoryBuffer(3),
+		WithIndex(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var input []*testRec
+	for i := 0; i < 20; i++ {
+		input = append(input, &testRec{key: (i * 7) % 4, name: fmt.Sprintf("r%d", i)})
+		sort.Write(input[i])
+	}
+	sort.Close()
+	var prev IndexedRecord
+	for i := 0; i < len(input); i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, ok := v.(IndexedRecord)
+		if !ok {
+			t.Fatalf("expected IndexedRecord, but got %T", v)
+		}
+		r := rec.Value.(*testRec)
+		if orig := input[rec.Index]; r.key != orig.key || r.name != orig.name {
+			t.Errorf("record %v has index %d, but the input record with that index is %v", r, rec.Index, orig)
+		}
+		if i > 0 {
+			p := prev.Value.(*testRec)
+			if p.key > r.key || p.key == r.key && prev.Index >= rec.Index {
+				t.Errorf("record %v with index %d came after %v with index %d", r, rec.Index, p, prev.Index)
+			}
+		}
+		prev = rec
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+}
+
+func TestUnsort(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithIndex(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []string{"d", "b", "e", "a", "b", "c", "a", "f"}
+	for _, s := range input {
+		sort.Write(s)
+	}
+	sort.Close()
+	var records []IndexedRecord
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		records = append(records, v.(IndexedRecord))
+	}
+	for i := 1; i < len(records); i++ {
+		if records[i].Value.(string) < records[i-1].Value.(string) {
+			t.Fatalf("records are not sorted: %v", records)
+		}
+	}
+	res := Unsort(records)
+	if len(res) != len(input) {
+		t.Fatalf("expected %d records but got %d", len(input), len(res))
+	}
+	for i, v := range res {
+		if v != input[i] {
+			t.Errorf("record %d: expected %s but got %v", i, input[i], v)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package ints implements methods that enable filesort to sort int64 values
+// stored to disk as fixed-width binary numbers.
+package ints
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// Less compares two int64 values and returns true if the first one is less
+// than the second one
+func Less(a, b interface{}) bool {
+	return a.(int64) < b.(int64)
+}
+
+type intEncoder struct {
+	w  io.WriteCloser
+	bw *bufio.Writer
+}
+
+// NewEncoder returns filesort.Encoder that writes int64 values as 8-byte
+// big-endian numbers, so spill files are compact and need no parsing.
+func NewEncoder(w io.WriteCloser) filesort.Encoder {
+	return &intEncoder{w: w, bw: bufio.NewWriter(w)}
+}
+
+func (ie *intEncoder) Encode(v interface{}) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v.(int64)))
+	_, err := ie.bw.Write(buf[:])
+	return err
+}
+
+func (ie *intEncoder) Close() error {
+	if err := ie.bw.Flush(); err != nil {
+		ie.w.Close()
+		return err
+	}
+	return ie.w.Close()
+}
+
+type intDecoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder returns filesort.Decoder that reads int64 values written by the
+// Encoder returned by NewEncoder. It returns nil and io.EOF in the end of the
+// stream. If r is a *bufio.Reader, the decoder reads from it directly instead
+// of adding a buffer of its own.
+func NewDecoder(r io.Reader) filesort.Decoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &intDecoder{r: br}
+}
+
+func (id *intDecoder) Decode() (interface{}, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(id.r, buf[:]); err != nil {
+		return nil, err
+	}
+	return int64(binary.BigEndian.Uint64(buf[:])), nil
+}
@@ -0,0 +1,164 @@
+package ints
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+	"gitlab.com/shaydo/go-filesort/text"
+)
+
+func Example() {
+	sort, err := filesort.New(
+		filesort.WithLess(Less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+	)
+	if err != nil {
+		panic(err)
+	}
+	for _, v := range []int64{3, -1, 2} {
+		sort.Write(v)
+	}
+	sort.Close()
+	for {
+		res, err := sort.Read()
+		if err != nil {
+			panic(err)
+		}
+		if res == nil {
+			break
+		}
+		fmt.Println(res)
+	}
+	// Output:
+	// -1
+	// 2
+	// 3
+}
+
+func TestIntSort(t *testing.T) {
+	sort, err := filesort.New(
+		filesort.WithLess(Less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []int64{5, -1 << 62, 0, 1 << 62, -7, 42, -1, 1, 9}
+	for _, v := range input {
+		if err := sort.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Close()
+	for _, exp := range []int64{-1 << 62, -7, -1, 0, 1, 5, 9, 42, 1 << 62} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %d but got %v", exp, v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", v, err)
+	}
+}
+
+func benchmarkSort(b *testing.B, convert func(v int64) interface{}, opts ...filesort.Option) {
+	r := rand.New(rand.NewSource(1))
+	input := make([]interface{}, 100000)
+	for i := range input {
+		input[i] = convert(r.Int63())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sort, err := filesort.New(append(opts, filesort.WithMaxMemoryBuffer(10000))...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, v := range input {
+			sort.Write(v)
+		}
+		sort.Close()
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkInts(b *testing.B) {
+	benchmarkSort(b, func(v int64) interface{} { return v },
+		filesort.WithLess(Less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+	)
+}
+
+func BenchmarkIntsAsText(b *testing.B) {
+	// numbers are zero-padded, so they sort as strings
+	benchmarkSort(b, func(v int64) interface{} { return fmt.Sprintf("%019d", v) },
+		filesort.WithLess(text.Less),
+		filesort.WithEncoderNew(text.NewEncoder),
+		filesort.WithDecoderNew(text.NewDecoder),
+	)
+}
+
+func TestTotalMergeReadAhead(t *testing.T) {
+	const (
+		fanIn  = 512
+		budget = 64 << 10
+	)
+	sort, err := filesort.New(
+		filesort.WithLess(Less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(2),
+		filesort.WithSyncClose(),
+		filesort.WithTotalMergeReadAhead(budget),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*fanIn; i++ {
+		if err := sort.Write(int64(2*fanIn - i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the runs are all spilled by now, what gets allocated from here on is
+	// the merge reading fanIn runs at once
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 1; ; i++ {
+		res, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res == nil {
+			break
+		}
+		if res.(int64) != int64(i) {
+			t.Fatalf("expected %d, got %v", i, res)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	// besides the read-ahead budget every run takes its file, reader and
+	// decoder, but no buffer of its own
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > budget+fanIn*1024 {
+		t.Errorf("the merge of %d runs allocated %d bytes with read-ahead budget %d", fanIn, alloc, budget)
+	}
+}
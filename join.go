@@ -0,0 +1,53 @@
+package filesort
+
+// MergeJoin reads sorted records from left and right and calls emit for every
+// pair of records with equal keys, so it performs an inner join of the two
+// datasets. Both inputs must be sorted by the keys in the order defined by
+// less. If several records on both sides share the same key, emit is called
+// for every combination of them, so records of the right side with the same
+// key are kept in memory.
+func MergeJoin(left, right *FileSort, key func(v interface{}) interface{}, less Less, emit func(l, r interface{})) error {
+	l, err := left.Read()
+	if err != nil {
+		return err
+	}
+	r, err := right.Read()
+	if err != nil {
+		return err
+	}
+	for l != nil && r != nil {
+		lk, rk := key(l), key(r)
+		if less(lk, rk) {
+			if l, err = left.Read(); err != nil {
+				return err
+			}
+			continue
+		}
+		if less(rk, lk) {
+			if r, err = right.Read(); err != nil {
+				return err
+			}
+			continue
+		}
+		// collect all the right records with the same key
+		group := []interface{}{r}
+		for {
+			if r, err = right.Read(); err != nil {
+				return err
+			}
+			if r == nil || less(rk, key(r)) {
+				break
+			}
+			group = append(group, r)
+		}
+		for l != nil && !less(rk, key(l)) {
+			for _, g := range group {
+				emit(l, g)
+			}
+			if l, err = left.Read(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
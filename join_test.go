@@ -0,0 +1,40 @@
+package filesort
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeJoin(t *testing.T) {
+	key := func(v interface{}) interface{} { return strings.SplitN(v.(string), ":", 2)[0] }
+	less := func(a, b interface{}) bool { return a.(string) < b.(string) }
+	newSort := func(records ...string) *FileSort {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return less(key(a), key(b)) }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(2),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			sort.Write(r)
+		}
+		sort.Close()
+		return sort
+	}
+	left := newSort("c:l1", "a:l2", "e:l3", "b:l4", "c:l5", "f:l6")
+	right := newSort("b:r1", "c:r2", "d:r3", "c:r4", "f:r5", "g:r6")
+	var got []string
+	err := MergeJoin(left, right, key, less, func(l, r interface{}) {
+		got = append(got, l.(string)+"+"+r.(string))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"b:l4+b:r1", "c:l1+c:r2", "c:l1+c:r4", "c:l5+c:r2", "c:l5+c:r4", "f:l6+f:r5"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v but got %v", expected, got)
+	}
+}
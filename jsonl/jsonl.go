@@ -0,0 +1,90 @@
+// Package jsonl implements methods that enable filesort to sort arbitrary
+// JSON values that are stored to disk as JSON Lines, one value per line.
+// Newlines in strings are escaped by the JSON encoding, so they don't break
+// the lines.
+package jsonl
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+type jsonlEncoder struct {
+	w   io.WriteCloser
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewEncoder returns filesort.Encoder that encodes values as JSON, writing
+// every value on a separate line.
+func NewEncoder(w io.WriteCloser) filesort.Encoder {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &jsonlEncoder{w: w, bw: bw, enc: enc}
+}
+
+func (je *jsonlEncoder) Encode(v interface{}) error {
+	return je.enc.Encode(v)
+}
+
+func (je *jsonlEncoder) Close() error {
+	if err := je.bw.Flush(); err != nil {
+		je.w.Close()
+		return err
+	}
+	return je.w.Close()
+}
+
+type jsonlDecoder struct {
+	dec      *json.Decoder
+	newValue func() interface{}
+}
+
+// NewDecoder returns filesort.Decoder that reads JSON Lines and decodes every
+// line into map[string]interface{}.
+func NewDecoder(r io.Reader) filesort.Decoder {
+	return &jsonlDecoder{dec: json.NewDecoder(r)}
+}
+
+// NewDecoderFunc returns the constructor of filesort.Decoder that decodes
+// every line into the value returned by newValue, which must be a pointer,
+// and returns that pointer. Use it to sort values of a custom type, the
+// encoder then gets the same pointers.
+func NewDecoderFunc(newValue func() interface{}) func(r io.Reader) filesort.Decoder {
+	return func(r io.Reader) filesort.Decoder {
+		return &jsonlDecoder{dec: json.NewDecoder(r), newValue: newValue}
+	}
+}
+
+func (jd *jsonlDecoder) Decode() (interface{}, error) {
+	if jd.newValue != nil {
+		v := jd.newValue()
+		if err := jd.dec.Decode(v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	var m map[string]interface{}
+	if err := jd.dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Field returns the value of the field of the decoded JSON object found by
+// following the path of keys through nested objects, or nil if there's no
+// such field.
+func Field(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
@@ -0,0 +1,117 @@
+package jsonl
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+func Example() {
+	// order objects by the nested "user.name" field
+	less := func(a, b interface{}) bool {
+		na, _ := Field(a, "user", "name").(string)
+		nb, _ := Field(b, "user", "name").(string)
+		return na < nb
+	}
+	sort, err := filesort.New(
+		filesort.WithLess(less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+	)
+	if err != nil {
+		panic(err)
+	}
+	sort.Write(map[string]interface{}{"id": 1, "user": map[string]interface{}{"name": "Danny"}})
+	sort.Write(map[string]interface{}{"id": 2, "user": map[string]interface{}{"name": "Alice"}})
+	sort.Write(map[string]interface{}{"id": 3, "user": map[string]interface{}{"name": "Charly"}})
+	sort.Write(map[string]interface{}{"id": 4, "user": map[string]interface{}{"name": "Bob"}})
+	sort.Close()
+	for {
+		res, err := sort.Read()
+		if err != nil {
+			panic(err)
+		}
+		if res == nil {
+			// end of output
+			break
+		}
+		fmt.Println(res.(map[string]interface{})["id"], Field(res, "user", "name"))
+	}
+	// Output:
+	// 2 Alice
+	// 4 Bob
+	// 3 Charly
+	// 1 Danny
+}
+
+func TestJSONLSort(t *testing.T) {
+	less := func(a, b interface{}) bool {
+		return a.(map[string]interface{})["key"].(string) < b.(map[string]interface{})["key"].(string)
+	}
+	sort, err := filesort.New(
+		filesort.WithLess(less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []map[string]interface{}{
+		{"key": "d", "text": "horse"},
+		{"key": "b", "text": "multi\nline\n"},
+		{"key": "a", "text": "\"quoted\"\r\n"},
+		{"key": "c", "text": "<html>"},
+		{"key": "e", "nested": map[string]interface{}{"n": 1.5}},
+	}
+	for _, v := range input {
+		if err := sort.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Close()
+	for _, i := range []int{2, 1, 3, 0, 4} {
+		res, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, input[i]) {
+			t.Errorf("expected %v but got %v", input[i], res)
+		}
+	}
+	if res, err := sort.Read(); res != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", res, err)
+	}
+}
+
+type testEvent struct {
+	Name string `json:"name"`
+	Time int    `json:"time"`
+}
+
+func TestJSONLDecoderFunc(t *testing.T) {
+	sort, err := filesort.New(
+		filesort.WithLess(func(a, b interface{}) bool { return a.(*testEvent).Time < b.(*testEvent).Time }),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoderFunc(func() interface{} { return &testEvent{} })),
+		filesort.WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		sort.Write(&testEvent{Name: fmt.Sprint("event", i), Time: (i * 3) % 7})
+	}
+	sort.Close()
+	for i := 0; i < 7; i++ {
+		res, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev := res.(*testEvent); ev.Time != i || ev.Name != fmt.Sprint("event", i*5%7) {
+			t.Errorf("expected event %d at time %d, but got %v", i*5%7, i, ev)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package filesort
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+type keyCacheEntry struct {
+	id     interface{}
+	record interface{}
+	key    interface{}
+}
+
+// keyCache is an LRU cache of the keys extracted from records. Records are
+// identified by the address of their data for reference types and by value
+// for hashable types, other records aren't cached. Entries hold the records,
+// so their addresses can't be reused by other records while they are cached.
+type keyCache struct {
+	mu      sync.Mutex
+	size    int
+	extract func(v interface{}) interface{}
+	lru     *list.List
+	entries map[interface{}]*list.Element
+}
+
+func newKeyCache(size int, extract func(v interface{}) interface{}) *keyCache {
+	return &keyCache{
+		size:    size,
+		extract: extract,
+		lru:     list.New(),
+		entries: make(map[interface{}]*list.Element),
+	}
+}
+
+type sliceID struct {
+	ptr uintptr
+	len int
+}
+
+// recordID returns a value identifying the record that can be used as a map
+// key, or nil if the record can't be identified.
+func recordID(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return rv.Pointer()
+	case reflect.Slice:
+		return sliceID{ptr: rv.Pointer(), len: rv.Len()}
+	}
+	if hashable(rv.Type()) {
+		return v
+	}
+	return nil
+}
+
+// hashable reports whether every value of type t can be used as a map key.
+// Comparable structs and arrays with interface fields aren't, as hashing
+// panics if such a field holds a slice or a map.
+func hashable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Array:
+		return hashable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !hashable(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return t.Comparable()
+}
+
+func (kc *keyCache) key(v interface{}) interface{} {
+	if kc.size <= 0 {
+		return kc.extract(v)
+	}
+	id := recordID(v)
+	if id == nil {
+		return kc.extract(v)
+	}
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if el, ok := kc.entries[id]; ok {
+		kc.lru.MoveToFront(el)
+		return el.Value.(*keyCacheEntry).key
+	}
+	key := kc.extract(v)
+	kc.entries[id] = kc.lru.PushFront(&keyCacheEntry{id: id, record: v, key: key})
+	if kc.lru.Len() > kc.size {
+		el := kc.lru.Back()
+		kc.lru.Remove(el)
+		delete(kc.entries, el.Value.(*keyCacheEntry).id)
+	}
+	return key
+}
+
+// reset removes all the keys from the cache.
+func (kc *keyCache) reset() {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.lru.Init()
+	kc.entries = make(map[interface{}]*list.Element)
+}
@@ -0,0 +1,140 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"testing"
+)
+
+func TestKeyCache(t *testing.T) {
+	run := func(size int) int {
+		var calls int
+		extract := func(v interface{}) interface{} {
+			calls++
+			n, _ := strconv.Atoi(v.(string))
+			return n
+		}
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(int) < b.(int) }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(10),
+			WithKeyCache(size, extract),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprintf("%d", (i*37)%100))
+		}
+		sort.Close()
+		for i := 0; i < 100; i++ {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := fmt.Sprintf("%d", i); v.(string) != exp {
+				t.Fatalf("expected %s but got %v", exp, v)
+			}
+		}
+		return calls
+	}
+	uncached := run(0)
+	cached := run(64)
+	if cached >= uncached {
+		t.Errorf("expected cache to reduce number of extractions, but got %d with cache and %d without", cached, uncached)
+	}
+}
+
+type testIntPtrEncoder struct {
+	Encoder
+}
+
+func (pe testIntPtrEncoder) Encode(v interface{}) error {
+	return pe.Encoder.Encode(strconv.Itoa(*v.(*int)))
+}
+
+type testIntPtrDecoder struct {
+	Decoder
+}
+
+func (pd testIntPtrDecoder) Decode() (interface{}, error) {
+	v, err := pd.Decoder.Decode()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(v.(string))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func TestKeyCacheAddressReuse(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(int) < b.(int) }),
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return testIntPtrEncoder{newTestLineEncoder(w)} }),
+		WithDecoderNew(func(r io.Reader) Decoder { return testIntPtrDecoder{newTestLineDecoder(r)} }),
+		WithMaxMemoryBuffer(100),
+		// records are identified by their addresses
+		WithKeyCache(1<<20, func(v interface{}) interface{} { return *v.(*int) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer debug.SetGCPercent(debug.SetGCPercent(1))
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		n := r.Intn(1000000)
+		sort.Write(&n)
+	}
+	sort.Close()
+	prev := -1
+	for i := 0; ; i++ {
+		// collect the records that have been read, so their addresses
+		// can be reused by the records decoded from the spill files
+		if i%1000 == 0 {
+			runtime.GC()
+		}
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		if n := *v.(*int); n < prev {
+			t.Fatalf("record %d is %d, which is less than the previous one %d", i, n, prev)
+		} else {
+			prev = n
+		}
+	}
+}
+
+func TestKeyCacheUnhashable(t *testing.T) {
+	type record struct {
+		name  string
+		value interface{}
+	}
+	kc := newKeyCache(4, func(v interface{}) interface{} {
+		switch r := v.(type) {
+		case record:
+			return r.name
+		case [1]interface{}:
+			return r[0].(map[string]int)["k"]
+		}
+		return nil
+	})
+	// the types are comparable, but their values with a slice or a map in
+	// an interface field can't be hashed
+	if key := kc.key(record{name: "a", value: []int{1}}); key != "a" {
+		t.Errorf("expected key a, but got %v", key)
+	}
+	if key := kc.key([1]interface{}{map[string]int{"k": 2}}); key != 2 {
+		t.Errorf("expected key 2, but got %v", key)
+	}
+}
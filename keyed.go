@@ -0,0 +1,75 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+)
+
+// keyedRecord is a value written with WriteWithKey together with its key.
+type keyedRecord struct {
+	key   interface{}
+	value interface{}
+}
+
+// keyedEncoder writes the key followed by the value for every record using
+// the configured Encoder. A nil value can't be written, as the Decoder
+// returns nil in the end of the stream, so it couldn't be read back.
+type keyedEncoder struct {
+	Encoder
+}
+
+func (ke keyedEncoder) Encode(v interface{}) error {
+	kr := v.(keyedRecord)
+	if kr.value == nil {
+		return fmt.Errorf("couldn't spill the nil value for the key %v", kr.key)
+	}
+	if err := ke.Encoder.Encode(kr.key); err != nil {
+		return err
+	}
+	return ke.Encoder.Encode(kr.value)
+}
+
+// keyedDecoder reads the key followed by the value for every record using
+// the configured Decoder.
+type keyedDecoder struct {
+	Decoder
+}
+
+func (kd keyedDecoder) Decode() (interface{}, error) {
+	key, err := kd.Decoder.Decode()
+	if err != nil || key == nil {
+		return key, err
+	}
+	value, err := kd.Decoder.Decode()
+	if err == io.EOF || (err == nil && value == nil) {
+		return nil, fmt.Errorf("missing value for the key %v", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyedRecord{key: key, value: value}, nil
+}
+
+// WriteWithKey writes a value for sorting to FileSort together with its key.
+// Records are ordered by their keys, which are passed to the comparison
+// function instead of the values, and Read returns the values only. Both the
+// key and the value are stored to disk using the configured Encoder, so it
+// must be able to encode both. Records written with WriteWithKey and Write
+// can't be mixed in the same sort, and WriteWithKey can't be used together
+// with WithRecord. The value may be nil only if the records fit into the
+// memory buffer, the sort fails if it has to spill a nil value.
+func (ps *FileSort) WriteWithKey(key, value interface{}) error {
+	return ps.Write(keyedRecord{key: key, value: value})
+}
+
+// outputValue strips the key from the record written with WriteWithKey.
+func (ps *FileSort) outputValue(v interface{}) interface{} {
+	if !ps.keyed {
+		return v
+	}
+	if ir, ok := v.(IndexedRecord); ok {
+		ir.Value = ir.Value.(keyedRecord).value
+		return ir
+	}
+	return v.(keyedRecord).value
+}
@@ -0,0 +1,98 @@
+package filesort
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWriteWithKey(t *testing.T) {
+	for _, withIndex := range []bool{false, true} {
+		opts := []Option{WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(3)}
+		if withIndex {
+			opts = append(opts, WithIndex())
+		}
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			n := (i * 3) % 10
+			// keys are in the reverse order of the values
+			if err := sort.WriteWithKey(fmt.Sprintf("k%d", 9-n), fmt.Sprintf("v%d", n)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sort.Close()
+		for i := 9; i >= 0; i-- {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if withIndex {
+				ir := v.(IndexedRecord)
+				if exp := int64((i * 7) % 10); ir.Index != exp {
+					t.Errorf("expected index %d but got %d", exp, ir.Index)
+				}
+				v = ir.Value
+			}
+			if exp := fmt.Sprintf("v%d", i); v != exp {
+				t.Errorf("expected %s but got %v", exp, v)
+			}
+		}
+		if v, err := sort.Read(); v != nil || err != nil {
+			t.Errorf("expected end of output, but got %v %v", v, err)
+		}
+	}
+}
+
+func TestWriteWithKeyMixed(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.WriteWithKey("a", "b")
+	sort.Write("c")
+	sort.Close()
+	if _, err := sort.Read(); err == nil {
+		t.Error("expected an error when mixing Write and WriteWithKey")
+	}
+}
+
+func TestReadOK(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.WriteWithKey("b", nil)
+	sort.WriteWithKey("a", "x")
+	sort.WriteWithKey("c", nil)
+	sort.Close()
+	for _, exp := range []interface{}{"x", nil, nil} {
+		v, ok, err := sort.ReadOK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || v != exp {
+			t.Errorf("expected %v but got %v %v", exp, v, ok)
+		}
+	}
+	if v, ok, err := sort.ReadOK(); ok || v != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v %v", v, ok, err)
+	}
+}
+
+func TestReadOKSpill(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.WriteWithKey("b", nil)
+	sort.WriteWithKey("a", "x")
+	sort.Close()
+	// the nil value is spilled, and it couldn't be told apart from the end
+	// of the spill file
+	if v, ok, err := sort.ReadOK(); err == nil || !strings.Contains(err.Error(), "nil value") {
+		t.Errorf("expected an error for the spilled nil value, but got %v %v %v", v, ok, err)
+	}
+}
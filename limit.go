@@ -0,0 +1,57 @@
+package filesort
+
+// WithLimit makes FileSort output only the first n records of the sorted
+// output, e.g. to find the n smallest records. When the memory buffer is
+// full, it's sorted and all but the first n records are dropped, so if n is
+// small compared to the size of the buffer, nothing is spilled to disk, and
+// otherwise the spill files contain at most n records each. If there are
+// fewer than n records, all of them are output. Records are dropped only at
+// the output with WithAdjacentUnique, WithUnique, WithMonotonicKeys or
+// WithWatermark. It can't be used with WithOutputReverse.
+func WithLimit(n int) Option {
+	return func(ps *FileSort) {
+		ps.limit = n
+	}
+}
+
+// canPrune returns true if the records in the memory buffer that are beyond
+// the limit can be dropped.
+func (ps *FileSort) canPrune() bool {
+	return ps.limit > 0 && ps.adjacentEqual == nil && !ps.monotonic && ps.watermark == nil
+}
+
+// pruneBuffer sorts the full memory buffer and drops the records beyond the
+// limit. If the rest takes no more than half of the buffer, it's kept in
+// memory, otherwise it's spilled to disk.
+func (ps *FileSort) pruneBuffer() error {
+	if err := ps.sortBuffer(); err != nil {
+		return err
+	}
+	if len(ps.buffer) > ps.limit {
+		for i := ps.limit; i < len(ps.buffer); i++ {
+			ps.buffer[i] = nil
+		}
+		ps.buffer = ps.buffer[:ps.limit]
+		ps.bufferLen = ps.limit
+		ps.bufferBytes = 0
+		for _, v := range ps.buffer {
+			ps.bufferBytes += recordSize(v, ps.sizeEstimate)
+		}
+	}
+	if ps.noSpill || ps.hasRoom() {
+		return nil
+	}
+	if err := ps.flushBuffer(ps.tempDir); err != nil {
+		return err
+	}
+	return ps.compact()
+}
+
+// hasRoom returns true if the records in the memory buffer take no more than
+// half of its maximum size.
+func (ps *FileSort) hasRoom() bool {
+	if ps.maxBytes > 0 {
+		return ps.bufferBytes*2 <= ps.maxBytes
+	}
+	return ps.bufferLen*2 <= ps.bufferMax
+}
@@ -0,0 +1,67 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit, records, spills int
+	}{
+		// the records within the limit fit into the memory buffer
+		{5, 1000, 0},
+		// every full buffer is spilled after dropping the records beyond
+		// the limit
+		{15, 1000, 50},
+		// the limit is larger than the input
+		{2000, 1000, 50},
+	} {
+		var spills int
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:3] < b.(string)[:3] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(20),
+			WithLimit(tc.limit),
+			WithSpillWarning(func(n int) { spills = n }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// every key is written twice, equal records must stay in the
+		// insertion order
+		for i := 0; i < tc.records; i++ {
+			sort.Write(fmt.Sprintf("%03d-%d", (i*37)%(tc.records/2), i))
+		}
+		sort.Close()
+		var res []string
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+			res = append(res, v.(string))
+		}
+		exp := tc.limit
+		if exp > tc.records {
+			exp = tc.records
+		}
+		if len(res) != exp {
+			t.Fatalf("limit %d: expected %d records but got %d", tc.limit, exp, len(res))
+		}
+		for i, v := range res {
+			var key, index int
+			fmt.Sscanf(v, "%03d-%d", &key, &index)
+			if key != i/2 || i%2 == 1 && index < tc.records/2 {
+				t.Errorf("limit %d: unexpected record %s at position %d", tc.limit, v, i)
+			}
+		}
+		if spills != tc.spills {
+			t.Errorf("limit %d: expected %d spills but got %d", tc.limit, tc.spills, spills)
+		}
+	}
+}
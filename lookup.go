@@ -0,0 +1,21 @@
+package filesort
+
+// ByLookup returns a comparison function that orders records by the rank of
+// their keys in the lookup table, records with lower rank come first. keyFn
+// returns the key of the record. Records with keys missing from the table
+// come after all the others. The table is copied, so the comparison function
+// doesn't change and is safe to use even if rank is modified later.
+func ByLookup(rank map[string]int, keyFn func(v interface{}) string) Less {
+	snapshot := make(map[string]int, len(rank))
+	for k, r := range rank {
+		snapshot[k] = r
+	}
+	return func(a, b interface{}) bool {
+		ra, oka := snapshot[keyFn(a)]
+		rb, okb := snapshot[keyFn(b)]
+		if !oka || !okb {
+			return oka && !okb
+		}
+		return ra < rb
+	}
+}
@@ -0,0 +1,38 @@
+package filesort
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestByLookup(t *testing.T) {
+	popularity := map[string]int{"p3": 1, "p1": 2, "p4": 3, "p2": 4}
+	less := ByLookup(popularity, func(v interface{}) string {
+		return strings.SplitN(v.(string), ":", 2)[0]
+	})
+	// changing the table afterwards doesn't affect the sort
+	popularity["p2"] = 0
+	delete(popularity, "p3")
+	sort, err := New(
+		WithLess(less),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"p1:a", "p5:b", "p2:c", "p3:d", "p4:e", "p1:f", "p6:g"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	for _, exp := range []string{"p3:d", "p1:a", "p1:f", "p4:e", "p2:c", "p5:b", "p6:g"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %s but got %v", exp, v)
+		}
+	}
+}
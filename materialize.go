@@ -0,0 +1,198 @@
+package filesort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// sortedFileBlock is the number of records in a block of SortedFile.
+const sortedFileBlock = 128
+
+// SortedFile is a file with sorted records written by MaterializeSorted
+// together with its metadata.
+type SortedFile struct {
+	path       string
+	count      int64
+	min        interface{}
+	max        interface{}
+	size       int64
+	newDecoder func(r io.Reader) Decoder
+	blocks     []sortedFileBlockInfo
+}
+
+// sortedFileBlockInfo is an entry of the sparse index of SortedFile.
+type sortedFileBlockInfo struct {
+	// first is the first record of the block
+	first interface{}
+	// position is the number of records before the block
+	position int64
+	// offset and size are the position and the size of the block in bytes
+	offset, size int64
+}
+
+// Path returns the path to the file.
+func (sf *SortedFile) Path() string { return sf.path }
+
+// Count returns the number of records in the file.
+func (sf *SortedFile) Count() int64 { return sf.count }
+
+// Min returns the smallest record in the file, or nil if it is empty.
+func (sf *SortedFile) Min() interface{} { return sf.min }
+
+// Max returns the largest record in the file, or nil if it is empty.
+func (sf *SortedFile) Max() interface{} { return sf.max }
+
+// Size returns the size of the file in bytes.
+func (sf *SortedFile) Size() int64 { return sf.size }
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// MaterializeSorted reads all sorted records and writes them using the
+// configured Encoder into the file at path, returning the handle that
+// describes the file. Records are written in blocks of sortedFileBlock
+// records, each encoded by a separate Encoder, so that the blocks can be
+// decoded independently by Search. For encoders that don't write any headers,
+// such as line based ones, the file is the same as if it was written by a
+// single Encoder. The smallest and the largest records are the first and the
+// last ones in the sort order, so with WithOutputReverse they are taken from
+// the end and the beginning of the file respectively, and the file can't be
+// searched.
+func (ps *FileSort) MaterializeSorted(path string) (*SortedFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create output file: %v", err)
+	}
+	defer file.Close()
+	bw := bufio.NewWriter(file)
+	cw := &countingWriter{w: bw}
+	sf := &SortedFile{path: path, newDecoder: ps.newDecoder}
+	var (
+		enc         Encoder
+		first, last interface{}
+	)
+	closeBlock := func() error {
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("error when closing encoder: %v", err)
+		}
+		enc = nil
+		b := &sf.blocks[len(sf.blocks)-1]
+		b.size = cw.n - b.offset
+		return nil
+	}
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			if enc != nil {
+				enc.Close()
+			}
+			return nil, err
+		}
+		if v == nil {
+			break
+		}
+		if enc == nil {
+			sf.blocks = append(sf.blocks, sortedFileBlockInfo{first: v, position: sf.count, offset: cw.n})
+			enc = ps.newEncoder(nopWriteCloser{cw})
+		}
+		if err := enc.Encode(v); err != nil {
+			enc.Close()
+			return nil, fmt.Errorf("couldn't encode a value: %v", err)
+		}
+		if first == nil {
+			first = v
+		}
+		last = v
+		sf.count++
+		if sf.count%sortedFileBlock == 0 {
+			if err := closeBlock(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if enc != nil {
+		if err := closeBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("couldn't write output file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("couldn't close output file: %v", err)
+	}
+	sf.min, sf.max = first, last
+	if ps.outputReverse {
+		sf.min, sf.max = last, first
+		sf.blocks = nil
+	}
+	sf.size = cw.n
+	return sf, nil
+}
+
+// Search looks for target in the file using less, which must order records
+// the same way as the file is sorted. It finds the block that may contain
+// target using the sparse index kept in memory and then decodes only that
+// block. It returns the position of the first record equal to target counting
+// from 0 and true if there is such record, or the position where target
+// would be inserted and false otherwise. Files written with WithOutputReverse
+// can't be searched.
+func (sf *SortedFile) Search(target interface{}, less Less) (int64, bool, error) {
+	if sf.blocks == nil && sf.count > 0 {
+		return 0, false, fmt.Errorf("file %s has no index for searching", sf.path)
+	}
+	// the first block starting with a record not less than target
+	j := sort.Search(len(sf.blocks), func(i int) bool { return !less(sf.blocks[i].first, target) })
+	if j > 0 {
+		// the first occurrence may be at the end of the previous block
+		pos, found, err := sf.searchBlock(&sf.blocks[j-1], target, less)
+		if err != nil || found || pos < sf.blocks[j-1].position+sortedFileBlock {
+			return pos, found, err
+		}
+	}
+	if j == len(sf.blocks) {
+		return sf.count, false, nil
+	}
+	return sf.blocks[j].position, !less(target, sf.blocks[j].first), nil
+}
+
+// searchBlock decodes the block and returns the position of the first record
+// not less than target and whether it is equal to target. If all the records
+// are less, the position after the block is returned.
+func (sf *SortedFile) searchBlock(b *sortedFileBlockInfo, target interface{}, less Less) (int64, bool, error) {
+	file, err := os.Open(sf.path)
+	if err != nil {
+		return 0, false, fmt.Errorf("couldn't open sorted file: %v", err)
+	}
+	defer file.Close()
+	dec := sf.newDecoder(io.NewSectionReader(file, b.offset, b.size))
+	if c, ok := dec.(io.Closer); ok {
+		defer c.Close()
+	}
+	pos := b.position
+	for {
+		v, err := dec.Decode()
+		if err != nil && err != io.EOF {
+			return 0, false, fmt.Errorf("error while decoding a record: %v", err)
+		}
+		if v == nil {
+			return b.position + sortedFileBlock, false, nil
+		}
+		if !less(v, target) {
+			return pos, !less(target, v), nil
+		}
+		pos++
+	}
+}
@@ -0,0 +1,109 @@
+package filesort
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaterializeSorted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, reverse := range []bool{false, true} {
+		opts := []Option{
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(4),
+		}
+		if reverse {
+			opts = append(opts, WithOutputReverse())
+		}
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			sort.Write(fmt.Sprintf("%02d", (i*7)%20))
+		}
+		sort.Close()
+		path := filepath.Join(dir, fmt.Sprintf("sorted-%v", reverse))
+		sf, err := sort.MaterializeSorted(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		for i, line := range lines {
+			exp := fmt.Sprintf("%02d", i)
+			if reverse {
+				exp = fmt.Sprintf("%02d", 19-i)
+			}
+			if line != exp {
+				t.Errorf("reverse %v: expected line %d to be %s but got %s", reverse, i, exp, line)
+			}
+		}
+		if sf.Path() != path || sf.Count() != int64(len(lines)) || sf.Size() != int64(len(data)) {
+			t.Errorf("reverse %v: metadata path=%s count=%d size=%d doesn't match the file with %d lines and %d bytes",
+				reverse, sf.Path(), sf.Count(), sf.Size(), len(lines), len(data))
+		}
+		if sf.Min() != "00" || sf.Max() != "19" {
+			t.Errorf("reverse %v: expected range [00, 19] but got [%v, %v]", reverse, sf.Min(), sf.Max())
+		}
+	}
+}
+
+func TestSortedFileSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(50),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every even key is repeated 3 times, so some of them cross block
+	// boundaries
+	const n = 600
+	for i := n - 1; i >= 0; i-- {
+		sort.Write(fmt.Sprintf("%04d", i/3*2))
+	}
+	sort.Close()
+	sf, err := sort.MaterializeSorted(filepath.Join(dir, "sorted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.blocks) < 4 {
+		t.Fatalf("expected the file to have several blocks, but it has %d", len(sf.blocks))
+	}
+	check := func(target string, expPos int64, expFound bool) {
+		pos, found, err := sf.Search(target, testLessLine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != expPos || found != expFound {
+			t.Errorf("search for %q: expected (%d, %v) but got (%d, %v)", target, expPos, expFound, pos, found)
+		}
+	}
+	for m := 0; m < n/3; m++ {
+		check(fmt.Sprintf("%04d", 2*m), int64(3*m), true)
+		check(fmt.Sprintf("%04d", 2*m+1), int64(3*m+3), false)
+	}
+	check("", 0, false)
+	check("9999", n, false)
+}
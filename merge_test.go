@@ -0,0 +1,185 @@
+package filesort
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testMergeRec struct {
+	key, run, pos int
+}
+
+func lessTestMergeRec(a, b interface{}) bool { return a.(testMergeRec).key < b.(testMergeRec).key }
+
+// testMergeRuns returns n sorted runs of the given length with many equal
+// keys.
+func testMergeRuns(n, length int) [][]interface{} {
+	rnd := rand.New(rand.NewSource(1))
+	runs := make([][]interface{}, n)
+	for i := range runs {
+		key := 0
+		for j := 0; j < length; j++ {
+			key += rnd.Intn(3)
+			runs[i] = append(runs[i], testMergeRec{key: key, run: i, pos: j})
+		}
+	}
+	return runs
+}
+
+func testMergeReaders(runs [][]interface{}) []Reader {
+	readers := make([]Reader, len(runs))
+	for i, run := range runs {
+		readers[i] = &sliceReader{slice: run, run: i}
+	}
+	return readers
+}
+
+func TestMergeReader(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 7, 64} {
+		runs := testMergeRuns(n, 50)
+		// the merge must return the same as the stable sort of all the
+		// runs concatenated in their order
+		var exp []interface{}
+		for _, run := range runs {
+			exp = append(exp, run...)
+		}
+		sort.SliceStable(exp, func(i, j int) bool { return lessTestMergeRec(exp[i], exp[j]) })
+		mr, err := newMergeReader(lessTestMergeRec, testMergeReaders(runs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			v, err := mr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				if i != len(exp) {
+					t.Fatalf("%d runs: expected %d records, but got %d", n, len(exp), i)
+				}
+				break
+			}
+			if i >= len(exp) || v != exp[i] {
+				t.Fatalf("%d runs: unexpected record %d %v", n, i, v)
+			}
+			if origin := readerOrigin(mr); n > 0 && origin != v.(testMergeRec).run {
+				t.Fatalf("%d runs: record %v has origin %d", n, v, origin)
+			}
+		}
+	}
+}
+
+// treeMergeReader is the merge reader that was used before the loser tree.
+// It merges readers pairwise in a binary tree of closures and is only kept as
+// the baseline for the merge benchmarks.
+type treeMergeReader struct {
+	next func() (interface{}, error)
+}
+
+func (mr *treeMergeReader) Next() (interface{}, error) {
+	return mr.next()
+}
+
+func newTreeMergeReader(less func(a, b interface{}) bool, rs []Reader) (Reader, error) {
+	n := len(rs)
+	if n == 0 {
+		return &sliceReader{}, nil
+	}
+	if n == 1 {
+		return rs[0], nil
+	}
+	var rs0, rs1 Reader
+	var err error
+	if n == 2 {
+		rs0 = rs[0]
+		rs1 = rs[1]
+	} else {
+		n = n / 2
+		if rs0, err = newTreeMergeReader(less, rs[:n]); err != nil {
+			return nil, err
+		}
+		if rs1, err = newTreeMergeReader(less, rs[n:]); err != nil {
+			return nil, err
+		}
+	}
+	n0, err := rs0.Next()
+	if err != nil {
+		return nil, err
+	}
+	if n0 == nil {
+		return rs1, nil
+	}
+	n1, err := rs1.Next()
+	if err != nil {
+		return nil, err
+	}
+	next := func() (interface{}, error) {
+		var err error
+		if n0 == nil {
+			return nil, nil
+		}
+		if n1 == nil {
+			res := n0
+			if n0, err = rs0.Next(); err != nil {
+				return nil, err
+			}
+			return res, nil
+		}
+		if !less(n1, n0) {
+			res := n0
+			if n0, err = rs0.Next(); err != nil {
+				return nil, err
+			}
+			if n0 == nil {
+				n0 = n1
+				n1 = nil
+				rs0 = rs1
+			}
+			return res, nil
+		}
+		res := n1
+		if n1, err = rs1.Next(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+	return &treeMergeReader{next: next}, nil
+}
+
+func benchmarkMerge(b *testing.B, newReader func(less func(a, b interface{}) bool, rs []Reader) (Reader, error)) {
+	runs := testMergeRuns(256, 200)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mr, err := newReader(lessTestMergeRec, testMergeReaders(runs))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for {
+			v, err := mr.Next()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkMerge256(b *testing.B) { benchmarkMerge(b, newMergeReader) }
+
+func BenchmarkMerge256Tree(b *testing.B) { benchmarkMerge(b, newTreeMergeReader) }
+
+func ExampleMergeSlices() {
+	mr := MergeSlices(func(a, b interface{}) bool { return a.(int) < b.(int) }, []interface{}{1, 4, 7}, []interface{}{2, 3, 8})
+	for {
+		v, _ := mr.Next()
+		if v == nil {
+			break
+		}
+		fmt.Print(v, " ")
+	}
+	// Output: 1 2 3 4 7 8
+}
@@ -0,0 +1,71 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// RunFile describes a sorted file merged by MergeFiles.
+type RunFile struct {
+	// Path is the path to the file
+	Path string
+	// NewDecoder returns the decoder for the records of the file
+	NewDecoder func(r io.Reader) Decoder
+}
+
+// MergedFiles is a Reader returning the records of several sorted files in
+// the merged order.
+type MergedFiles struct {
+	mr      Reader
+	readers []*fileReader
+	heads   int64
+}
+
+// MergeFiles opens the files, which must be sorted in the order defined by
+// less, and returns a Reader that merges them into a single sorted stream.
+// Every file is read with its own decoder, so files in different formats can
+// be merged as long as the decoded records can be compared by less. Records
+// that are equal are returned in the order of the files. The returned reader
+// must be closed after use.
+func MergeFiles(less Less, files ...RunFile) (*MergedFiles, error) {
+	mf := &MergedFiles{}
+	readers := make([]Reader, 0, len(files))
+	for _, f := range files {
+		file, err := os.Open(f.Path)
+		if err != nil {
+			mf.Close()
+			return nil, fmt.Errorf("couldn't open a file to merge: %v", err)
+		}
+		fr := &fileReader{
+			file:  file,
+			dec:   f.NewDecoder(file),
+			heads: &mf.heads,
+		}
+		mf.readers = append(mf.readers, fr)
+		readers = append(readers, fr)
+	}
+	mr, err := newMergeReader(less, readers)
+	if err != nil {
+		mf.Close()
+		return nil, err
+	}
+	mf.mr = mr
+	return mf, nil
+}
+
+// Next returns the next record or nil when all the files have been read.
+func (mf *MergedFiles) Next() (interface{}, error) {
+	return mf.mr.Next()
+}
+
+// Close closes all the files.
+func (mf *MergedFiles) Close() error {
+	var res error
+	for _, fr := range mf.readers {
+		if err := fr.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
@@ -0,0 +1,91 @@
+package filesort
+
+import (
+	"encoding/csv"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testCSVDecoder struct{ r *csv.Reader }
+
+func (d testCSVDecoder) Decode() (interface{}, error) {
+	rec, err := d.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+type testGobDecoder struct{ dec *gob.Decoder }
+
+func (d testGobDecoder) Decode() (interface{}, error) {
+	var rec []string
+	if err := d.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func TestMergeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	csvPath := filepath.Join(dir, "run.csv")
+	f, err := os.Create(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := csv.NewWriter(f)
+	cw.WriteAll([][]string{{"a", "csv"}, {"c", "csv"}, {"d", "csv"}, {"f", "csv"}})
+	f.Close()
+	gobPath := filepath.Join(dir, "run.gob")
+	if f, err = os.Create(gobPath); err != nil {
+		t.Fatal(err)
+	}
+	enc := gob.NewEncoder(f)
+	for _, rec := range [][]string{{"b", "gob"}, {"c", "gob"}, {"e", "gob"}} {
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+
+	less := func(a, b interface{}) bool { return a.([]string)[0] < b.([]string)[0] }
+	mf, err := MergeFiles(less,
+		RunFile{Path: gobPath, NewDecoder: func(r io.Reader) Decoder { return testGobDecoder{gob.NewDecoder(r)} }},
+		RunFile{Path: csvPath, NewDecoder: func(r io.Reader) Decoder { return testCSVDecoder{csv.NewReader(r)} }},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	var res [][]string
+	for {
+		v, err := mf.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		res = append(res, v.([]string))
+	}
+	exp := [][]string{{"a", "csv"}, {"b", "gob"}, {"c", "gob"}, {"c", "csv"}, {"d", "csv"}, {"e", "gob"}, {"f", "csv"}}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("expected %v but got %v", exp, res)
+	}
+}
+
+func TestMergeFilesMissing(t *testing.T) {
+	_, err := MergeFiles(testLessLine, RunFile{Path: "/nonexistent/run", NewDecoder: newTestLineDecoder})
+	if err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,31 @@
+package filesort
+
+// emitMonotonic is called instead of flushBuffer when the sorted memory
+// buffer is full and FileSort has been created with WithMonotonicKeys. It
+// outputs the batch held from the previous call if the current one doesn't
+// overlap with it and holds the current batch instead, otherwise it spills
+// both batches and turns off early output.
+func (ps *FileSort) emitMonotonic() error {
+	if len(ps.pending) > 0 && ps.less(ps.buffer[0], ps.pending[len(ps.pending)-1]) {
+		ps.monotonicFailed = true
+		err := ps.spill(ps.tempDir, ps.pending)
+		ps.pending = nil
+		if err != nil {
+			return err
+		}
+		return ps.flushBuffer(ps.tempDir)
+	}
+	for _, v := range ps.pending {
+		if err := ps.emit(v, -1); err != nil {
+			return err
+		}
+	}
+	if len(ps.pending) > 0 {
+		ps.emittedLast = ps.pending[len(ps.pending)-1]
+	}
+	ps.pending = ps.buffer
+	ps.buffer = nil
+	ps.bufferLen = 0
+	ps.bufferBytes = 0
+	return nil
+}
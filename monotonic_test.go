@@ -0,0 +1,118 @@
+package filesort
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMonotonicSort(t *testing.T, opts ...Option) *FileSort {
+	sort, err := New(append([]Option{
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(10),
+		WithMonotonicKeys(),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sort
+}
+
+func readTestLines(t *testing.T, sort *FileSort) []string {
+	var res []string
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			return res
+		}
+		res = append(res, v.(string))
+	}
+}
+
+func TestMonotonicKeys(t *testing.T) {
+	sort := newTestMonotonicSort(t)
+	// records are shuffled inside of every batch of 10
+	for i := 0; i < 50; i++ {
+		sort.Write(fmt.Sprintf("%03d", i/10*10+(i*3)%10))
+	}
+	first := make(chan interface{})
+	go func() {
+		v, _ := sort.Read()
+		first <- v
+	}()
+	select {
+	case v := <-first:
+		if v != "000" {
+			t.Errorf("expected 000 but got %v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output before the input has been closed")
+	}
+	sort.Close()
+	res := readTestLines(t, sort)
+	if len(res) != 49 {
+		t.Fatalf("expected 49 more records but got %d", len(res))
+	}
+	for i, s := range res {
+		if exp := fmt.Sprintf("%03d", i+1); s != exp {
+			t.Errorf("expected %s but got %s", exp, s)
+		}
+	}
+}
+
+func TestMonotonicKeysFallback(t *testing.T) {
+	var warnings int
+	sort := newTestMonotonicSort(t, WithSpillWarning(func(int) { warnings++ }), WithSyncClose())
+	// the second batch overlaps with the first one, so nothing can be output
+	// early, but the output is still sorted
+	var input []string
+	for i := 0; i < 40; i++ {
+		input = append(input, fmt.Sprintf("%03d", (i*7)%40))
+	}
+	for _, s := range input {
+		sort.Write(s)
+	}
+	sort.Close()
+	// the held batch is spilled like the others, so all four runs are
+	// reported
+	if warnings != 4 {
+		t.Errorf("expected 4 spill warnings, but got %d", warnings)
+	}
+	res := readTestLines(t, sort)
+	if len(res) != 40 {
+		t.Fatalf("expected 40 records but got %d", len(res))
+	}
+	for i, s := range res {
+		if exp := fmt.Sprintf("%03d", i); s != exp {
+			t.Errorf("expected %s but got %s", exp, s)
+		}
+	}
+}
+
+func TestMonotonicKeysViolated(t *testing.T) {
+	sort := newTestMonotonicSort(t)
+	for i := 0; i < 30; i++ {
+		sort.Write(fmt.Sprintf("%03d", i+100))
+	}
+	// the first batch has been output by now
+	sort.Write("000")
+	sort.Close()
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			if !strings.Contains(err.Error(), "monotonic") {
+				t.Errorf("expected monotonic keys error, but got %v", err)
+			}
+			break
+		}
+		if v == nil {
+			t.Fatal("expected an error, but got EOF")
+		}
+	}
+}
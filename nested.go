@@ -0,0 +1,49 @@
+package filesort
+
+import (
+	"reflect"
+	"sort"
+)
+
+// SortNested returns a copy of the slice v, which may be of any slice type,
+// with its elements sorted using less. The sort is stable. Elements that are
+// slices themselves are sorted recursively with the same less before the
+// outer slice is sorted, so less must handle both levels in that case. If v
+// isn't a slice, it's returned as is.
+//
+// SortNested sorts in memory, so it's meant for collections nested in
+// records sorted by FileSort. Sort the top level with FileSort and the nested
+// collections lazily as the records are read by passing a function that
+// calls SortNested to WithOutputTransform, e.g.:
+//
+//	WithOutputTransform(func(v interface{}) (interface{}, error) {
+//		r := v.(Record)
+//		r.Items = SortNested(r.Items, lessItems).([]Item)
+//		return r, nil
+//	})
+func SortNested(v interface{}, less Less) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return v
+	}
+	elems := make([]reflect.Value, rv.Len())
+	values := make([]interface{}, rv.Len())
+	for i := range elems {
+		elem := rv.Index(i)
+		if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Interface && elem.Elem().Kind() == reflect.Slice {
+			elem = reflect.ValueOf(SortNested(elem.Interface(), less))
+		}
+		elems[i] = elem
+		values[i] = elem.Interface()
+	}
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return less(values[order[i]], values[order[j]]) })
+	res := reflect.MakeSlice(rv.Type(), len(order), len(order))
+	for i, j := range order {
+		res.Index(i).Set(elems[j])
+	}
+	return res.Interface()
+}
@@ -0,0 +1,75 @@
+package filesort
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testNestedRecord struct {
+	Name  string
+	Items []int
+}
+
+func TestSortNested(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(testNestedRecord).Name < b.(testNestedRecord).Name }),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithOutputTransform(func(v interface{}) (interface{}, error) {
+			r := v.(testNestedRecord)
+			r.Items = SortNested(r.Items, func(a, b interface{}) bool { return a.(int) < b.(int) }).([]int)
+			return r, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []testNestedRecord{
+		{"c", []int{3, 1, 2}},
+		{"a", []int{9, 7, 8, 7}},
+		{"b", nil},
+		{"d", []int{5}},
+	}
+	for _, r := range input {
+		sort.Write(r)
+	}
+	sort.Close()
+	expected := []testNestedRecord{
+		{"a", []int{7, 7, 8, 9}},
+		{"b", []int{}},
+		{"c", []int{1, 2, 3}},
+		{"d", []int{5}},
+	}
+	for _, exp := range expected {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, exp) {
+			t.Errorf("expected %v but got %v", exp, v)
+		}
+	}
+	if !reflect.DeepEqual(input[0].Items, []int{3, 1, 2}) {
+		t.Errorf("expected the original slice to stay unchanged, but got %v", input[0].Items)
+	}
+}
+
+func TestSortNestedSlices(t *testing.T) {
+	// inner slices are sorted first and then ordered by their first element
+	less := func(a, b interface{}) bool {
+		switch a := a.(type) {
+		case int:
+			return a < b.(int)
+		case []int:
+			return a[0] < b.([]int)[0]
+		}
+		return false
+	}
+	res := SortNested([][]int{{5, 4}, {3, 9, 1}, {2}}, less)
+	if exp := [][]int{{1, 3, 9}, {2}, {4, 5}}; !reflect.DeepEqual(res, exp) {
+		t.Errorf("expected %v but got %v", exp, res)
+	}
+	if res := SortNested("not a slice", less); res != "not a slice" {
+		t.Errorf("expected a value that isn't a slice to be returned as is, but got %v", res)
+	}
+}
@@ -0,0 +1,32 @@
+package filesort
+
+// WithNullsOrdering makes FileSort put records for which isNull returns true
+// before all the other records if first is true, or after them otherwise,
+// like NULLS FIRST and NULLS LAST in SQL. The comparison function is called
+// only for records that aren't null, and null records stay in the order they
+// have been written. isNull gets the same values as the comparison function,
+// e.g. keys of records written with WriteWithKey. The position of null
+// records doesn't change with WithReverse.
+func WithNullsOrdering(first bool, isNull func(v interface{}) bool) Option {
+	return func(ps *FileSort) {
+		ps.nullsFirst = first
+		ps.isNull = isNull
+	}
+}
+
+// lessNulls returns a comparison function that orders null records before or
+// after the others and the rest using less.
+func lessNulls(less func(a, b interface{}) bool, isNull func(v interface{}) bool, first bool) func(a, b interface{}) bool {
+	return func(a, b interface{}) bool {
+		na, nb := isNull(a), isNull(b)
+		switch {
+		case na && nb:
+			return false
+		case na:
+			return first
+		case nb:
+			return !first
+		}
+		return less(a, b)
+	}
+}
@@ -0,0 +1,48 @@
+package filesort
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNullsOrdering(t *testing.T) {
+	for _, tc := range []struct {
+		first, reverse bool
+		expected       []string
+	}{
+		{true, false, []string{"", "-", "", "a", "b", "c", "d"}},
+		{false, false, []string{"a", "b", "c", "d", "", "-", ""}},
+		{true, true, []string{"", "-", "", "d", "c", "b", "a"}},
+		{false, true, []string{"d", "c", "b", "a", "", "-", ""}},
+	} {
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(2),
+			WithReverse(tc.reverse),
+			WithNullsOrdering(tc.first, func(v interface{}) bool { return v == "" || v == "-" }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"c", "", "a", "-", "d", "", "b"} {
+			sort.Write(s)
+		}
+		sort.Close()
+		var res []string
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+			res = append(res, v.(string))
+		}
+		if !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("first %v, reverse %v: expected %q but got %q", tc.first, tc.reverse, tc.expected, res)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package filesort
+
+// output is a sorted record together with the run it came from.
+type output struct {
+	value interface{}
+	run   int
+	// key is the record before the output transform and equal is the
+	// number of records output so far that are equal to it, they are only
+	// set with WithMergeCheckpoint
+	key   interface{}
+	equal int
+}
+
+// readerOrigin returns the run the record last returned by the reader came
+// from, or -1 if the reader doesn't track it.
+func readerOrigin(r Reader) int {
+	switch r := r.(type) {
+	case *sliceReader:
+		return r.run
+	case *fileReader:
+		return r.run
+	case *timeoutReader:
+		return r.fr.run
+	case *mergeReader:
+		return r.last
+	}
+	return -1
+}
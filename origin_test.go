@@ -0,0 +1,49 @@
+package filesort
+
+import "testing"
+
+func TestReadWithOrigin(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two spill files of 3 records and the memory buffer with 2 records
+	input := []string{"h", "b", "e", "a", "g", "c", "f", "d"}
+	origin := map[string]int{}
+	for i, s := range input {
+		origin[s] = i / 3
+		sort.Write(s)
+	}
+	sort.Close()
+	var prev string
+	n := 0
+	for {
+		v, run, err := sort.ReadWithOrigin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			if run != -1 {
+				t.Errorf("expected run -1 in the end of the stream, but got %d", run)
+			}
+			break
+		}
+		s := v.(string)
+		if s < prev {
+			t.Errorf("%s came after %s", s, prev)
+		}
+		prev = s
+		if run != origin[s] {
+			t.Errorf("expected %s to come from run %d, but got %d", s, origin[s], run)
+		}
+		n++
+	}
+	if n != len(input) {
+		t.Errorf("expected %d records but got %d", len(input), n)
+	}
+}
@@ -0,0 +1,97 @@
+package filesort
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// outputWriteBuffer is the size of the buffer used by OutputReader.WriteTo.
+const outputWriteBuffer = 64 * 1024
+
+// OutputReader is io.Reader of the sorted records encoded with the
+// configured Encoder, e.g. as lines of text or CSV. It also implements
+// io.WriterTo, so io.Copy writes all the remaining records to the destination
+// in large chunks without copying them through Read. Note that Read returns
+// data as soon as the Encoder writes it, so with an Encoder that buffers its
+// output it may have to encode many records first.
+type OutputReader struct {
+	ps   *FileSort
+	enc  Encoder
+	buf  bytes.Buffer
+	dst  io.Writer
+	done bool
+}
+
+// OutputReader returns the reader of the sorted output. Records must not be
+// read from FileSort directly while the reader is used.
+func (ps *FileSort) OutputReader() *OutputReader {
+	or := &OutputReader{ps: ps}
+	or.dst = &or.buf
+	or.enc = ps.newEncoder(nopWriteCloser{outputSink{or}})
+	return or
+}
+
+// outputSink passes the data written by the encoder to the current
+// destination of OutputReader.
+type outputSink struct {
+	or *OutputReader
+}
+
+func (s outputSink) Write(p []byte) (int, error) {
+	return s.or.dst.Write(p)
+}
+
+// next encodes the next sorted record, or closes the encoder in the end of
+// the output.
+func (or *OutputReader) next() error {
+	v, ok, err := or.ps.ReadOK()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		or.done = true
+		if err := or.enc.Close(); err != nil {
+			return fmt.Errorf("error when closing encoder: %v", err)
+		}
+		return nil
+	}
+	if err := or.enc.Encode(v); err != nil {
+		return fmt.Errorf("couldn't encode a value: %v", err)
+	}
+	return nil
+}
+
+// Read reads the encoded sorted records into p.
+func (or *OutputReader) Read(p []byte) (int, error) {
+	for or.buf.Len() == 0 && !or.done {
+		if err := or.next(); err != nil {
+			return 0, err
+		}
+	}
+	if or.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return or.buf.Read(p)
+}
+
+// WriteTo writes all the remaining encoded sorted records to w and returns
+// the number of bytes written.
+func (or *OutputReader) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if _, err := or.buf.WriteTo(cw); err != nil {
+		return cw.n, err
+	}
+	bw := bufio.NewWriterSize(cw, outputWriteBuffer)
+	or.dst = bw
+	defer func() { or.dst = &or.buf }()
+	for !or.done {
+		if err := or.next(); err != nil {
+			bw.Flush()
+			return cw.n, err
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
@@ -0,0 +1,73 @@
+package filesort
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// testCountingWriter counts the calls of Write.
+type testCountingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (cw *testCountingWriter) Write(p []byte) (int, error) {
+	cw.writes++
+	return cw.Buffer.Write(p)
+}
+
+func TestOutputReader(t *testing.T) {
+	newSort := func() *FileSort {
+		sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10000; i++ {
+			sort.Write(fmt.Sprintf("%04d", (i*7919)%10000))
+		}
+		sort.Close()
+		return sort
+	}
+	var exp bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&exp, "%04d\n", i)
+	}
+
+	// io.Copy uses WriteTo
+	var out testCountingWriter
+	n, err := io.Copy(&out, newSort().OutputReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(exp.Len()) || out.String() != exp.String() {
+		t.Errorf("expected %d bytes of sorted output, but got %d", exp.Len(), n)
+	}
+	if max := exp.Len()/outputWriteBuffer + 1; out.writes > max {
+		t.Errorf("expected at most %d writes, but got %d", max, out.writes)
+	}
+
+	// WriteTo continues after Read
+	or := newSort().OutputReader()
+	head := make([]byte, 7)
+	if _, err := io.ReadFull(or, head); err != nil {
+		t.Fatal(err)
+	}
+	var rest bytes.Buffer
+	if _, err := io.Copy(&rest, or); err != nil {
+		t.Fatal(err)
+	}
+	if res := string(head) + rest.String(); res != exp.String() {
+		t.Errorf("expected sorted output, but got %d bytes", len(res))
+	}
+
+	res, err := ioutil.ReadAll(struct{ io.Reader }{newSort().OutputReader()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != exp.String() {
+		t.Errorf("expected sorted output from Read, but got %d bytes", len(res))
+	}
+}
@@ -0,0 +1,173 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// pager keeps the sorted output in chunk files so it can be read in pages
+// from the end.
+type pager struct {
+	dir    string
+	chunks []string
+	sizes  []int
+	total  int
+}
+
+// writeChunk writes output records into a new file in dir. Chunks are written
+// like spill files, but with the configured Encoder only, as the output
+// records are neither keyed nor encoded for comparison.
+func (ps *FileSort) writeChunk(dir string, records []interface{}) (string, error) {
+	return ps.writeRecords(dir, func(w io.WriteCloser, name string) (Encoder, error) {
+		return ps.newEncoder(w), nil
+	}, records)
+}
+
+// readChunk reads all the records from the chunk file.
+func (ps *FileSort) readChunk(name string) ([]interface{}, error) {
+	return ps.readRecords(name, func(r io.Reader, name string) (Decoder, error) {
+		return ps.newDecoder(r), nil
+	}, nil)
+}
+
+// newPager creates the directory for the chunk files in the temporary
+// directory of the sort, or a new prefix for the objects of the ObjectStore.
+func (ps *FileSort) newPager() (*pager, error) {
+	if ps.store != nil {
+		prefix, err := newStorePrefix()
+		if err != nil {
+			return nil, err
+		}
+		return &pager{dir: prefix}, nil
+	}
+	dir, err := ioutil.TempDir(ps.tempParent, "filesort")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temporary directory: %v", err)
+	}
+	return &pager{dir: dir}, nil
+}
+
+// remove removes all the chunk files of the pager.
+func (pg *pager) remove(ps *FileSort) {
+	for _, name := range pg.chunks {
+		ps.removeRun(name)
+	}
+	if ps.store == nil {
+		os.RemoveAll(pg.dir)
+	}
+	pg.chunks = nil
+	pg.dir = ""
+}
+
+// materializePages reads the whole sorted output and stores it into chunk
+// files of up to bufferMax records.
+func (ps *FileSort) materializePages() (*pager, error) {
+	pg, err := ps.newPager()
+	if err != nil {
+		return nil, err
+	}
+	var chunk []interface{}
+	flush := func() error {
+		name, err := ps.writeChunk(pg.dir, chunk)
+		if name != "" {
+			pg.chunks = append(pg.chunks, name)
+		}
+		if err != nil {
+			return err
+		}
+		pg.sizes = append(pg.sizes, len(chunk))
+		pg.total += len(chunk)
+		chunk = chunk[:0]
+		return nil
+	}
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			pg.remove(ps)
+			return nil, err
+		}
+		if v == nil {
+			break
+		}
+		chunk = append(chunk, v)
+		if len(chunk) >= ps.bufferMax {
+			if err := flush(); err != nil {
+				pg.remove(ps)
+				return nil, err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			pg.remove(ps)
+			return nil, err
+		}
+	}
+	return pg, nil
+}
+
+// ReadPageFromEnd returns up to limit sorted records starting from the
+// offset-th record counted from the end of the output, the records are
+// returned in the descending order, so the first record of the page with
+// offset 0 is the last record of the output. The first call reads the whole
+// sorted output and stores it in temporary files, which requires as much
+// extra disk space as the data being sorted, and subsequent calls read pages
+// from these files, loading up to the size of the memory buffer at a time.
+// The files are written like spill files, so they are compressed and put
+// into the ObjectStore if the sort is configured so. ReadPageFromEnd can't be
+// used together with Read, and it returns an error with WithIndex. The files are kept till Abort is
+// called, even after all the pages have been read, so call Abort once the
+// pages are no longer needed.
+func (ps *FileSort) ReadPageFromEnd(offset, limit int) ([]interface{}, error) {
+	if ps.withIndex {
+		return nil, fmt.Errorf("pages from the end can't be read with index")
+	}
+	ps.pagerMu.Lock()
+	defer ps.pagerMu.Unlock()
+	if ps.pager == nil {
+		if ps.aborted() {
+			return nil, ps.abortErr
+		}
+		pg, err := ps.materializePages()
+		if err != nil {
+			return nil, err
+		}
+		ps.pager = pg
+	}
+	pg := ps.pager
+	if pg.dir == "" {
+		return nil, ps.abortErr
+	}
+	var page []interface{}
+	// end is the position of the chunk end counted from the end of output
+	end := 0
+	for i := len(pg.chunks) - 1; i >= 0 && len(page) < limit; i-- {
+		start := end + pg.sizes[i]
+		if start > offset {
+			records, err := ps.readChunk(pg.chunks[i])
+			if err != nil {
+				return nil, err
+			}
+			for j := len(records) - 1; j >= 0 && len(page) < limit; j-- {
+				if pos := end + len(records) - 1 - j; pos >= offset {
+					page = append(page, records[j])
+				}
+			}
+		}
+		end = start
+	}
+	return page, nil
+}
+
+// removePages removes the files created by ReadPageFromEnd.
+func (ps *FileSort) removePages() {
+	ps.pagerMu.Lock()
+	defer ps.pagerMu.Unlock()
+	if ps.pager == nil {
+		ps.pager = &pager{}
+		return
+	}
+	ps.pager.remove(ps)
+}
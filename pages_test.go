@@ -0,0 +1,144 @@
+package filesort
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadPageFromEnd(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Abort()
+	for i := 0; i < 23; i++ {
+		sort.Write(fmt.Sprintf("%02d", (i*5)%23))
+	}
+	sort.Close()
+	for _, tc := range []struct {
+		offset, limit int
+		expected      string
+	}{
+		{0, 3, "22,21,20"},
+		{3, 4, "19,18,17,16"},
+		{4, 7, "18,17,16,15,14,13,12"},
+		{20, 5, "02,01,00"},
+		{22, 1, "00"},
+		{23, 5, ""},
+		{10, 0, ""},
+	} {
+		page, err := sort.ReadPageFromEnd(tc.offset, tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, v := range page {
+			got = append(got, v.(string))
+		}
+		if strings.Join(got, ",") != tc.expected {
+			t.Errorf("offset %d, limit %d: expected %s but got %v", tc.offset, tc.limit, tc.expected, got)
+		}
+	}
+}
+
+func TestReadPageFromEndWithIndex(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Abort()
+	sort.Write("b")
+	sort.Write("a")
+	sort.Close()
+	if page, err := sort.ReadPageFromEnd(0, 2); err == nil {
+		t.Errorf("expected an error with index, but got %v", page)
+	}
+}
+
+func TestReadPageFromEndFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := newTestStore()
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		// chunks returns the contents of the chunk files
+		chunks func() [][]byte
+	}{
+		{"temp dir", []Option{WithTempDir(dir)}, nil},
+		{"compression", []Option{WithTempDir(dir), WithCompression(gzip.BestSpeed)}, nil},
+		{"store", []Option{WithObjectStore(store)}, func() [][]byte {
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			var chunks [][]byte
+			for _, data := range store.objects {
+				chunks = append(chunks, data)
+			}
+			return chunks
+		}},
+	} {
+		if tc.chunks == nil {
+			tc.chunks = func() [][]byte {
+				names, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var chunks [][]byte
+				for _, name := range names {
+					data, err := ioutil.ReadFile(name)
+					if err != nil {
+						t.Fatal(err)
+					}
+					chunks = append(chunks, data)
+				}
+				return chunks
+			}
+		}
+		sort, err := New(append([]Option{
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(5),
+		}, tc.opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 23; i++ {
+			sort.Write(fmt.Sprintf("%02d", (i*5)%23))
+		}
+		sort.Close()
+		page, err := sort.ReadPageFromEnd(3, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(page); got != "[19 18 17 16]" {
+			t.Errorf("%s: expected [19 18 17 16], but got %s", tc.name, got)
+		}
+		chunks := tc.chunks()
+		if len(chunks) != 5 {
+			t.Errorf("%s: expected 5 chunk files, but got %d", tc.name, len(chunks))
+		}
+		compressed := sort.compress
+		for _, data := range chunks {
+			if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) != compressed {
+				t.Errorf("%s: expected the chunk compressed %v, but got %q", tc.name, compressed, data)
+			}
+		}
+		sort.Abort()
+		if chunks := tc.chunks(); len(chunks) != 0 {
+			t.Errorf("%s: expected chunk files to be removed by Abort, but got %d", tc.name, len(chunks))
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("%s: expected the temporary directory to be empty, but it contains %d files", tc.name, len(files))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package filesort
+
+// WithParallelism sets the number of goroutines sorting and spilling full
+// memory buffers. If n is greater than 1, a full buffer is handed over to a
+// worker, which sorts it and writes it into a spill file, while new records
+// are added to a fresh buffer, so up to n buffers may be kept in memory in
+// addition to the one being filled. Spill files are merged in the order the
+// buffers have been filled, so the output is the same as with serial
+// sorting. The comparison function is called from several goroutines
+// concurrently, so it must be safe for that. Parallel spilling isn't used
+// with WithMonotonicKeys.
+func WithParallelism(n int) Option {
+	return func(ps *FileSort) {
+		ps.parallelism = n
+	}
+}
+
+// spillJob is a full memory buffer being sorted and spilled by a worker.
+type spillJob struct {
+	records []interface{}
+	name    string
+	err     error
+	done    chan struct{}
+}
+
+// spillParallel hands the full memory buffer over to a new worker and starts
+// a new buffer. If parallelism workers are already running, it waits for the
+// oldest one first.
+func (ps *FileSort) spillParallel() error {
+	if err := ps.checkTransitivityOnce(); err != nil {
+		return err
+	}
+	if err := ps.collectSpills(len(ps.spillJobs) - ps.parallelism + 1); err != nil {
+		return err
+	}
+	job := &spillJob{records: ps.buffer, done: make(chan struct{})}
+	ps.buffer = nil
+	ps.bufferLen = 0
+	ps.bufferBytes = 0
+	ps.spillJobs = append(ps.spillJobs, job)
+	go ps.runSpillJob(job)
+	return ps.compact()
+}
+
+// runSpillJob sorts the records of the job and writes them into a spill file.
+func (ps *FileSort) runSpillJob(job *spillJob) {
+	defer close(job.done)
+	records := job.records
+	job.records = nil
+	if job.err = ps.sortRecords(records); job.err != nil {
+		return
+	}
+	job.name, job.err = ps.writeRun(ps.tempDir, records)
+}
+
+// collectSpills adds the spill files of the finished jobs to the runs in the
+// order the jobs have been started, waiting for the first wait jobs to finish.
+func (ps *FileSort) collectSpills(wait int) error {
+	for len(ps.spillJobs) > 0 {
+		job := ps.spillJobs[0]
+		if wait <= 0 {
+			select {
+			case <-job.done:
+			default:
+				return nil
+			}
+		}
+		wait--
+		ps.spillJobs = ps.spillJobs[1:]
+		if err := ps.finishSpill(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitSpills waits for all the jobs and adds their spill files to the runs,
+// so they are removed even if some job has failed. It returns the first
+// error.
+func (ps *FileSort) waitSpills() error {
+	var first error
+	for _, job := range ps.spillJobs {
+		if err := ps.finishSpill(job); err != nil && first == nil {
+			first = err
+		}
+	}
+	ps.spillJobs = nil
+	return first
+}
+
+// finishSpills waits for all the jobs and compacts the spill files if there
+// are more of them than the compaction threshold.
+func (ps *FileSort) finishSpills() error {
+	if err := ps.waitSpills(); err != nil {
+		return err
+	}
+	for ps.compactThreshold > 0 && len(ps.files) > ps.compactThreshold {
+		if err := ps.compact(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *FileSort) finishSpill(job *spillJob) error {
+	<-job.done
+	if job.name != "" {
+		ps.files = append(ps.files, job.name)
+	}
+	if job.err != nil {
+		return job.err
+	}
+	return ps.spilled(job.name)
+}
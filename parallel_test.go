@@ -0,0 +1,91 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParallelism(t *testing.T) {
+	var input []string
+	for i := 0; i < 1000; i++ {
+		input = append(input, fmt.Sprintf("%d%03d", (i*7)%10, i))
+	}
+	sortAll := func(parallelism, compactThreshold int) []string {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(30),
+			WithParallelism(parallelism),
+			WithCompactThreshold(compactThreshold),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg := sort.Config(); cfg.Parallelism != parallelism {
+			t.Errorf("expected Parallelism %d in config, but got %d", parallelism, cfg.Parallelism)
+		}
+		for _, s := range input {
+			if err := sort.Write(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sort.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var res []string
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				return res
+			}
+			res = append(res, v.(string))
+		}
+	}
+	for _, threshold := range []int{0, 5} {
+		serial := sortAll(1, threshold)
+		if len(serial) != len(input) {
+			t.Fatalf("expected %d records, but got %d", len(input), len(serial))
+		}
+		for _, n := range []int{2, 4} {
+			res := sortAll(n, threshold)
+			if len(res) != len(serial) {
+				t.Fatalf("parallelism %d: expected %d records, but got %d", n, len(serial), len(res))
+			}
+			for i := range res {
+				if res[i] != serial[i] {
+					t.Errorf("parallelism %d: expected %s at %d, but got %s", n, serial[i], i, res[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestParallelismLessErr(t *testing.T) {
+	sort, err := New(
+		WithLessErr(func(a, b interface{}) (bool, error) {
+			if a == "bad" || b == "bad" {
+				return false, fmt.Errorf("bad record")
+			}
+			return a.(string) < b.(string), nil
+		}),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithParallelism(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"c", "b", "a", "f", "bad", "d", "i", "h", "g"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	if _, err := sort.Read(); err == nil {
+		t.Error("expected a comparison error")
+	}
+}
@@ -0,0 +1,137 @@
+package filesort
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Partitioned sorts records split into a number of partitions, each of which
+// is sorted independently by its own FileSort, so partitions are sorted and
+// merged in parallel. The output is the concatenation of the sorted
+// partitions in the order of their indices, so it is globally sorted only if
+// the partition function maps ordered ranges of records to increasing
+// partition indices.
+type Partitioned struct {
+	partition func(v interface{}) int
+	parts     []*FileSort
+	counts    []int64
+	current   int
+}
+
+// PartitionSummary describes the output of a partition, so that every
+// partition of a sharded pipeline can be validated independently.
+type PartitionSummary struct {
+	// Count is the number of records returned from the partition
+	Count int64
+	// Checksum is the checksum of the partition output as returned by
+	// OutputChecksum, or 0 if partitions were created without
+	// WithOutputChecksum
+	Checksum uint64
+}
+
+// NewPartitioned creates a new Partitioned object with numParts partitions.
+// The partition function returns the index of the partition for a record.
+// Options are applied to each of the partitions.
+func NewPartitioned(partition func(v interface{}) int, numParts int, opts ...Option) (*Partitioned, error) {
+	if numParts <= 0 {
+		return nil, fmt.Errorf("number of partitions must be positive")
+	}
+	p := &Partitioned{partition: partition}
+	for i := 0; i < numParts; i++ {
+		ps, err := New(opts...)
+		if err != nil {
+			p.Abort()
+			return nil, err
+		}
+		p.parts = append(p.parts, ps)
+	}
+	p.counts = make([]int64, numParts)
+	return p, nil
+}
+
+// Write writes a record for sorting into its partition.
+func (p *Partitioned) Write(v interface{}) error {
+	n := p.partition(v)
+	if n < 0 || n >= len(p.parts) {
+		return fmt.Errorf("partition index %d is out of range [0, %d)", n, len(p.parts))
+	}
+	return p.parts[n].Write(v)
+}
+
+// Close closes input of all the partitions and returns the first error
+// returned by their Close.
+func (p *Partitioned) Close() error {
+	var first error
+	for _, ps := range p.parts {
+		if err := ps.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Read returns the next sorted record or nil in the end of the stream.
+// Records of a partition are returned after all the records of the previous
+// partitions.
+func (p *Partitioned) Read() (interface{}, error) {
+	for p.current < len(p.parts) {
+		v, err := p.parts[p.current].Read()
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			p.counts[p.current]++
+			return v, nil
+		}
+		p.current++
+	}
+	return nil, nil
+}
+
+// Summaries returns the number of records and the checksum of the output of
+// every partition in the order of their indices. It must be called after Read
+// has returned the end of the stream. To get the checksums, pass
+// WithOutputChecksum to NewPartitioned.
+func (p *Partitioned) Summaries() []PartitionSummary {
+	res := make([]PartitionSummary, len(p.parts))
+	for i, ps := range p.parts {
+		res[i] = PartitionSummary{Count: p.counts[i], Checksum: ps.OutputChecksum()}
+	}
+	return res
+}
+
+// Abort aborts sorting of all the partitions.
+func (p *Partitioned) Abort() {
+	for _, ps := range p.parts {
+		ps.Abort()
+	}
+}
+
+// SamplePartition picks parts-1 splitter values from the sample of keys, so
+// that partitioning the data by the ranges between the splitters produces
+// partitions of roughly equal size, provided the sample is representative.
+// The splitters are returned in ascending order. The keys slice is not
+// modified.
+func SamplePartition(less Less, keys []interface{}, parts int) []interface{} {
+	if parts <= 1 || len(keys) == 0 {
+		return nil
+	}
+	sorted := make([]interface{}, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	splitters := make([]interface{}, parts-1)
+	for i := range splitters {
+		splitters[i] = sorted[(i+1)*len(sorted)/parts]
+	}
+	return splitters
+}
+
+// PartitionBySplitters returns a partition function suitable for
+// NewPartitioned that assigns records to len(splitters)+1 partitions. Records
+// less than the first splitter go to the partition 0, records not less than
+// the splitter i and less than the splitter i+1 go to the partition i+1.
+func PartitionBySplitters(less Less, splitters []interface{}) func(v interface{}) int {
+	return func(v interface{}) int {
+		return sort.Search(len(splitters), func(i int) bool { return less(v, splitters[i]) })
+	}
+}
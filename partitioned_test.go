@@ -0,0 +1,139 @@
+package filesort
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPartitioned(t *testing.T) {
+	sort, err := NewPartitioned(
+		func(v interface{}) int { return int(v.(string)[0]-'0') / 4 },
+		3,
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := sort.Write(fmt.Sprintf("%02d", (i*37)%100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sort.Write("x"); err == nil {
+		t.Error("expected an error for a record outside of partitions")
+	}
+	sort.Close()
+	for i := 0; i < 100; i++ {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := fmt.Sprintf("%02d", i); s != exp {
+			t.Fatalf("expected %s but got %v", exp, s)
+		}
+	}
+	if s, err := sort.Read(); s != nil || err != nil {
+		t.Errorf("expected end of output, but got %v %v", s, err)
+	}
+}
+
+func TestPartitionedCloseError(t *testing.T) {
+	sort, err := NewPartitioned(
+		func(v interface{}) int { return int(v.(string)[0] - 'a') },
+		2,
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(1),
+		WithNoSpill(),
+		WithSyncClose(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sort.Abort()
+	// only the second partition exceeds its memory buffer
+	for _, s := range []string{"a", "b", "b"} {
+		sort.Write(s)
+	}
+	if err := sort.Close(); err == nil {
+		t.Error("expected the error of the second partition from Close")
+	}
+}
+
+func TestSamplePartition(t *testing.T) {
+	less := func(a, b interface{}) bool { return a.(float64) < b.(float64) }
+	// the keys are heavily skewed towards zero
+	const n = 10000
+	keys := make([]interface{}, n)
+	for i := range keys {
+		x := float64((i*7919)%n) / n
+		keys[i] = x * x * x
+	}
+	var sample []interface{}
+	for i := 0; i < n; i += 10 {
+		sample = append(sample, keys[i])
+	}
+	splitters := SamplePartition(less, sample, 4)
+	if len(splitters) != 3 {
+		t.Fatalf("expected 3 splitters, but got %d", len(splitters))
+	}
+	partition := PartitionBySplitters(less, splitters)
+	sizes := make([]int, 4)
+	for _, k := range keys {
+		sizes[partition(k)]++
+	}
+	for i, size := range sizes {
+		if size < n/4*9/10 || size > n/4*11/10 {
+			t.Errorf("partition %d has %d records, expected about %d", i, size, n/4)
+		}
+	}
+}
+
+func TestPartitionedSummaries(t *testing.T) {
+	run := func(seed int) []PartitionSummary {
+		sort, err := NewPartitioned(
+			func(v interface{}) int { return int(v.(string)[0]-'0') / 4 },
+			3,
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(5),
+			WithOutputChecksum(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same records written in a different order every run
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprintf("%02d", (i*seed)%100))
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		return sort.Summaries()
+	}
+	first := run(37)
+	for i, exp := range []int64{40, 40, 20} {
+		if first[i].Count != exp {
+			t.Errorf("expected %d records in partition %d, but got %d", exp, i, first[i].Count)
+		}
+	}
+	if first[0].Checksum == first[1].Checksum || first[1].Checksum == first[2].Checksum {
+		t.Errorf("expected different checksums for different partitions, but got %v", first)
+	}
+	if second := run(73); !reflect.DeepEqual(first, second) {
+		t.Errorf("summaries differ between runs: %v and %v", first, second)
+	}
+}
@@ -0,0 +1,34 @@
+package filesort
+
+// Pause stops ingestion of records, so that the memory used by FileSort stops
+// growing, e.g. in response to memory pressure. Write blocks till Resume is
+// called, and the records already written but not yet added to the memory
+// buffer wait as well. If the memory buffer is full, it is flushed to disk
+// before the ingestion stops. The sort can still be aborted while paused.
+// Calling Pause on the paused FileSort has no effect.
+func (ps *FileSort) Pause() {
+	ps.pauseMu.Lock()
+	defer ps.pauseMu.Unlock()
+	if ps.resumed == nil {
+		ps.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues ingestion of records stopped by Pause. Calling Resume on
+// FileSort that isn't paused has no effect.
+func (ps *FileSort) Resume() {
+	ps.pauseMu.Lock()
+	defer ps.pauseMu.Unlock()
+	if ps.resumed != nil {
+		close(ps.resumed)
+		ps.resumed = nil
+	}
+}
+
+// pausedChan returns the channel that is closed when FileSort is resumed, or
+// nil if it isn't paused.
+func (ps *FileSort) pausedChan() chan struct{} {
+	ps.pauseMu.Lock()
+	defer ps.pauseMu.Unlock()
+	return ps.resumed
+}
@@ -0,0 +1,73 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprintf("%02d", 19-i))
+	}
+	sort.Pause()
+	sort.Pause()
+	written := make(chan struct{})
+	go func() {
+		for i := 10; i < 20; i++ {
+			sort.Write(fmt.Sprintf("%02d", 19-i))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("expected Write to block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n := sort.Stats().RecordsIn; n > 10 {
+		t.Errorf("expected at most 10 records to be ingested while paused, but got %d", n)
+	}
+	sort.Resume()
+	sort.Resume()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write is still blocked after Resume")
+	}
+	sort.Close()
+	for i := 0; i < 20; i++ {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := fmt.Sprintf("%02d", i); s != exp {
+			t.Fatalf("expected %s but got %v", exp, s)
+		}
+	}
+	if s, err := sort.Read(); s != nil || err != nil {
+		t.Errorf("expected end of output but got %v %v", s, err)
+	}
+}
+
+func TestPauseAbort(t *testing.T) {
+	sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Pause()
+	errc := make(chan error)
+	go func() { errc <- sort.Write("a") }()
+	sort.Abort()
+	select {
+	case err := <-errc:
+		if err != ErrAborted {
+			t.Errorf("expected ErrAborted but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write is still blocked after Abort")
+	}
+}
@@ -0,0 +1,43 @@
+package filesort
+
+// Phase is a phase of the sort reported to the function specified with
+// WithPhaseCallback.
+type Phase int
+
+const (
+	// Ingesting is the phase when records are written, sorted in memory and
+	// spilled to disk
+	Ingesting Phase = iota
+	// Merging is the phase after the input has been closed, when the spill
+	// files and the memory buffer are merged and sorted records are output
+	Merging
+	// Done is reported after all the sorted records have been output
+	// successfully
+	Done
+)
+
+func (p Phase) String() string {
+	switch p {
+	case Ingesting:
+		return "ingesting"
+	case Merging:
+		return "merging"
+	case Done:
+		return "done"
+	}
+	return "unknown"
+}
+
+// phase reports the phase to the callback if there is one, and the progress
+// reached by the start of the phase.
+func (ps *FileSort) phase(p Phase) {
+	switch p {
+	case Merging:
+		ps.reportProgress(50)
+	case Done:
+		ps.reportProgress(100)
+	}
+	if ps.phaseCallback != nil {
+		ps.phaseCallback(p)
+	}
+}
@@ -0,0 +1,99 @@
+package filesort
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPhaseCallback(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		phases []Phase
+		spills int
+	)
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSpillWarning(func(int) {
+			mu.Lock()
+			defer mu.Unlock()
+			spills++
+			if len(phases) != 1 || phases[0] != Ingesting {
+				t.Errorf("spill happened in phases %v", phases)
+			}
+		}),
+		WithPhaseCallback(func(p Phase) {
+			mu.Lock()
+			defer mu.Unlock()
+			phases = append(phases, p)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(9 - i))
+	}
+	sort.Close()
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(phases) != "[ingesting merging done]" {
+		t.Errorf("expected phases [ingesting merging done] but got %v", phases)
+	}
+	if spills != 3 {
+		t.Errorf("expected 3 spills but got %d", spills)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	for _, hint := range []int{100, 50, 400} {
+		var reported []float64
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(7),
+			WithTotalHint(hint),
+			WithProgress(func(percent float64) { reported = append(reported, percent) }),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprintf("%02d", 99-i))
+		}
+		sort.Close()
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				break
+			}
+		}
+		if len(reported) < 10 {
+			t.Fatalf("hint %d: expected progress to be reported many times, but got %v", hint, reported)
+		}
+		for i, p := range reported {
+			if p > 100 || i > 0 && p <= reported[i-1] {
+				t.Fatalf("hint %d: expected progress to grow up to 100%%, but got %v", hint, reported)
+			}
+		}
+		if last := reported[len(reported)-1]; last != 100 {
+			t.Errorf("hint %d: expected the last reported progress to be 100%%, but got %v", hint, last)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package filesort
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPlainTextSpill(t *testing.T) {
+	sortCmd, err := exec.LookPath("sort")
+	if err != nil {
+		t.Skip("sort command is not available")
+	}
+	// the transform blocks the merge before it emits the first record, so
+	// the spill files stay intact while they are merged externally
+	unblock := make(chan struct{})
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(10),
+		WithPlainTextSpill(),
+		WithSyncClose(),
+		WithOutputTransform(func(v interface{}) (interface{}, error) {
+			<-unblock
+			return v, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		sort.Write(fmt.Sprintf("line %d", (i*37)%50))
+	}
+	if err := sort.Close(); err != nil {
+		close(unblock)
+		t.Fatal(err)
+	}
+	if len(sort.files) != 5 {
+		t.Errorf("expected 5 spill files but got %d", len(sort.files))
+	}
+	cmd := exec.Command(sortCmd, append([]string{"-m"}, sort.files...)...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	external, err := cmd.Output()
+	close(unblock)
+	if err != nil {
+		t.Fatalf("sort -m failed: %v", err)
+	}
+	var lines []string
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		lines = append(lines, v.(string))
+	}
+	if len(lines) != 50 {
+		t.Errorf("expected 50 records but got %d", len(lines))
+	}
+	if exp := strings.Join(lines, "\n") + "\n"; string(external) != exp {
+		t.Errorf("sort -m output differs from the library output:\n%s\nexpected:\n%s", external, exp)
+	}
+}
+
+func TestPlainTextSpillKeyed(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithPlainTextSpill(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.WriteWithKey("a", "b")
+	sort.Close()
+	if v, err := sort.Read(); err == nil {
+		t.Errorf("expected an error, but got %v", v)
+	}
+}
@@ -0,0 +1,67 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPreKey(t *testing.T) {
+	sortWith := func(preKey bool) int {
+		var calls int
+		opts := []Option{
+			WithLess(func(a, b interface{}) bool {
+				calls++
+				return testLessLine(a, b)
+			}),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(10),
+			WithSyncClose(),
+		}
+		if preKey {
+			// the first byte of the string is monotonic with the string
+			// order
+			opts = append(opts, WithPreKey(func(v interface{}) uint64 {
+				if s := v.(string); s != "" {
+					return uint64(s[0])
+				}
+				return 0
+			}))
+		}
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprintf("%c%d", 'a'+(i*7)%26, i%3))
+		}
+		if err := sort.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var prev string
+		for n := 0; ; n++ {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				if n != 100 {
+					t.Errorf("expected 100 records but got %d", n)
+				}
+				break
+			}
+			if s := v.(string); s < prev {
+				t.Errorf("%s came after %s", s, prev)
+			} else {
+				prev = s
+			}
+		}
+		// the sort has finished, so it's safe to read the counter
+		<-sort.done
+		return calls
+	}
+	full, withPreKey := sortWith(false), sortWith(true)
+	if withPreKey*2 > full {
+		t.Errorf("expected pre-key to avoid most comparisons, but got %d full comparisons with it and %d without", withPreKey, full)
+	}
+}
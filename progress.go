@@ -0,0 +1,50 @@
+package filesort
+
+// WithTotalHint specifies the expected total number of records, which allows
+// the function set with WithProgress to report the progress in percent.
+func WithTotalHint(n int) Option {
+	return func(ps *FileSort) {
+		ps.totalHint = int64(n)
+	}
+}
+
+// WithProgress specifies the function that is called with the percentage of
+// the sort completed, which is computed from the number of records written
+// and output relative to the total set with WithTotalHint, so it isn't called
+// without the hint. Ingestion of the records makes up the first 50% and the
+// output of the sorted records the other 50%. The function is called every
+// time the progress has grown by at least a percent, and with 100 when the
+// sort is done. If there are more records than the hint, the progress of
+// each part stays at its upper bound till the end of that part, so the
+// reported percentage never decreases and never exceeds 100. The function is
+// called from the sorting goroutine and must not block for long.
+func WithProgress(fn func(percent float64)) Option {
+	return func(ps *FileSort) {
+		ps.progressFn = fn
+	}
+}
+
+// progress reports the progress of the part starting at offset percent that
+// has processed n records.
+func (ps *FileSort) progress(offset float64, n int64) {
+	if ps.progressFn == nil || ps.totalHint <= 0 {
+		return
+	}
+	part := 50 * float64(n) / float64(ps.totalHint)
+	if part > 50 {
+		part = 50
+	}
+	if percent := offset + part; percent >= ps.lastProgress+1 {
+		ps.reportProgress(percent)
+	}
+}
+
+// reportProgress calls the progress function if percent is above the last
+// reported value.
+func (ps *FileSort) reportProgress(percent float64) {
+	if ps.progressFn == nil || ps.totalHint <= 0 || percent <= ps.lastProgress {
+		return
+	}
+	ps.lastProgress = percent
+	ps.progressFn(percent)
+}
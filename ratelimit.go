@@ -0,0 +1,36 @@
+package filesort
+
+import "time"
+
+// rateLimiter is a token bucket holding at most one token, so the records are
+// spaced evenly in time and there are no bursts.
+type rateLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSec int) *rateLimiter {
+	return &rateLimiter{interval: time.Second / time.Duration(perSec)}
+}
+
+// wait blocks till the next token is available or abort is closed, in which
+// case it returns ErrAborted.
+func (rl *rateLimiter) wait(abort <-chan struct{}) error {
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	d := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-abort:
+		return ErrAborted
+	}
+}
@@ -0,0 +1,33 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReadRateLimit(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithReadRateLimit(200),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 41; i++ {
+		sort.Write(fmt.Sprintf("%02d", i))
+	}
+	sort.Close()
+	start := time.Now()
+	for i := 0; i < 41; i++ {
+		if _, err := sort.Read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 40 intervals of 5ms between 41 records
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected reading to take at least 200ms, but it took %v", elapsed)
+	}
+}
@@ -0,0 +1,37 @@
+package filesort
+
+// minReadAhead is the size of the smallest read-ahead buffer, bufio doesn't
+// allow smaller ones.
+const minReadAhead = 16
+
+// WithTotalMergeReadAhead specifies the total size in bytes of the read-ahead
+// buffers of the spill files read at once during the merge. The budget is
+// divided equally between the files, so the buffers shrink as the number of
+// merged files grows. If a buffer would be smaller than 16 bytes, the files
+// are read without read-ahead. By default spill files are read without
+// read-ahead.
+//
+// The buffer of each file is the *bufio.Reader passed to the decoder. The
+// decoders of the text, ints and gob packages read from it directly, so with
+// them the buffers stay within the budget regardless of the fan-in. Decoders
+// that buffer the input on their own, like the ones of the csv and jsonl
+// packages, and the decompression of WithCompression add their buffers for
+// every merged file on top of the budget.
+func WithTotalMergeReadAhead(bytes int) Option {
+	return func(ps *FileSort) {
+		ps.mergeReadAhead = bytes
+	}
+}
+
+// readAheadSize returns the size of the read-ahead buffer for each of fanIn
+// spill files read at once, or 0 if they should be read without read-ahead.
+func (ps *FileSort) readAheadSize(fanIn int) int {
+	if ps.mergeReadAhead <= 0 || fanIn <= 0 {
+		return 0
+	}
+	size := ps.mergeReadAhead / fanIn
+	if size < minReadAhead {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,46 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTotalMergeReadAhead(t *testing.T) {
+	const budget = 1000
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(2),
+		WithTotalMergeReadAhead(budget),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fanIn := range []int{1, 2, 10, 50, 62, 63, 1000} {
+		size := sort.readAheadSize(fanIn)
+		if size*fanIn > budget {
+			t.Errorf("fan-in %d: read-ahead of %d bytes per file exceeds the budget", fanIn, size)
+		}
+		if size != 0 && size < minReadAhead {
+			t.Errorf("fan-in %d: read-ahead of %d bytes is too small", fanIn, size)
+		}
+	}
+	if size := sort.readAheadSize(10); size != 100 {
+		t.Errorf("expected 100 bytes per file for fan-in 10, but got %d", size)
+	}
+	// 50 spill files are merged with 20 bytes of read-ahead each
+	for i := 0; i < 100; i++ {
+		sort.Write(fmt.Sprintf("%03d", (i*37)%100))
+	}
+	sort.Close()
+	for i := 0; i < 100; i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := fmt.Sprintf("%03d", i); v != exp {
+			t.Fatalf("expected %s but got %v", exp, v)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package filesort
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ReadAllInto reads all the remaining sorted records and appends them to the
+// slice dst points to, e.g. *[]int64 or *[]interface{}. Records must be
+// assignable to the type of the slice elements, they are never converted. If
+// some record isn't, ReadAllInto returns a *RecordTypeError and dst contains
+// the records read before it. So int64 records can't be read into *[]int,
+// even though Go converts between the two: the conversion truncates values
+// on 32-bit platforms, and converting only the records that fit would make
+// the result depend on the data, so convert the records after reading them
+// into *[]int64 if needed.
+func (ps *FileSort) ReadAllInto(dst interface{}) error {
+	ptr := reflect.ValueOf(dst)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a pointer to a slice, but it's %T", dst)
+	}
+	slice := ptr.Elem()
+	elemType := slice.Type().Elem()
+	defer func() { ptr.Elem().Set(slice) }()
+	for {
+		v, err := ps.Read()
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return nil
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.Type().AssignableTo(elemType) {
+			return &RecordTypeError{Record: v, Type: elemType}
+		}
+		slice = reflect.Append(slice, rv)
+	}
+}
+
+// RecordTypeError is returned by ReadAllInto if a record can't be assigned to
+// the elements of the destination slice.
+type RecordTypeError struct {
+	Record interface{}
+	Type   reflect.Type
+}
+
+func (e *RecordTypeError) Error() string {
+	return fmt.Sprintf("record of type %T can't be assigned to %v", e.Record, e.Type)
+}
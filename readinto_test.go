@@ -0,0 +1,146 @@
+package filesort
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testPerson struct {
+	Name string
+	Age  int
+}
+
+type testJSONEncoder struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+func newTestJSONEncoder(w io.WriteCloser) Encoder {
+	return &testJSONEncoder{w: w, enc: json.NewEncoder(w)}
+}
+
+func (je *testJSONEncoder) Encode(v interface{}) error { return je.enc.Encode(v) }
+
+func (je *testJSONEncoder) Close() error { return je.w.Close() }
+
+type testPersonDecoder struct {
+	dec *json.Decoder
+}
+
+func newTestPersonDecoder(r io.Reader) Decoder {
+	return &testPersonDecoder{dec: json.NewDecoder(r)}
+}
+
+func (pd *testPersonDecoder) Decode() (interface{}, error) {
+	var p testPerson
+	if err := pd.dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func TestReadAllInto(t *testing.T) {
+	sort, err := New(
+		WithLess(lessInt64),
+		WithEncoderNew(newTestIntEncoder),
+		WithDecoderNew(newTestIntDecoder),
+		WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []int64{5, 3, 1, 4, 2} {
+		sort.Write(v)
+	}
+	sort.Close()
+	ints := []int64{0}
+	if err := sort.ReadAllInto(&ints); err != nil {
+		t.Fatal(err)
+	}
+	if len(ints) != 6 {
+		t.Fatalf("expected 6 elements, but got %v", ints)
+	}
+	for i, v := range ints {
+		if v != int64(i) {
+			t.Errorf("expected %d at %d, but got %d", i, i, v)
+		}
+	}
+
+	sort, err = New(
+		WithLess(func(a, b interface{}) bool { return a.(testPerson).Age < b.(testPerson).Age }),
+		WithEncoderNew(newTestJSONEncoder),
+		WithDecoderNew(newTestPersonDecoder),
+		WithMaxMemoryBuffer(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := []testPerson{{"Carol", 40}, {"Alice", 20}, {"Dave", 50}, {"Bob", 30}}
+	for _, p := range input {
+		sort.Write(p)
+	}
+	sort.Close()
+	var people []testPerson
+	if err := sort.ReadAllInto(&people); err != nil {
+		t.Fatal(err)
+	}
+	exp := []testPerson{{"Alice", 20}, {"Bob", 30}, {"Carol", 40}, {"Dave", 50}}
+	if len(people) != len(exp) {
+		t.Fatalf("expected %d people, but got %v", len(exp), people)
+	}
+	for i := range exp {
+		if people[i] != exp[i] {
+			t.Errorf("expected %v at %d, but got %v", exp[i], i, people[i])
+		}
+	}
+	if err := sort.ReadAllInto(people); err == nil {
+		t.Error("expected an error for a slice passed by value")
+	}
+}
+
+func TestReadAllIntoMismatch(t *testing.T) {
+	newSort := func() *FileSort {
+		sort, err := New(
+			WithLess(lessInt64),
+			WithEncoderNew(newTestIntEncoder),
+			WithDecoderNew(newTestIntDecoder),
+			WithMaxMemoryBuffer(2),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []int64{300, 1 << 40, -1} {
+			sort.Write(v)
+		}
+		sort.Close()
+		return sort
+	}
+	// none of these may silently truncate, wrap or reinterpret the records
+	for _, dst := range []interface{}{
+		&[]int{}, &[]int8{}, &[]uint64{}, &[]float64{}, &[]string{}, &[]time.Duration{},
+	} {
+		sort := newSort()
+		err := sort.ReadAllInto(dst)
+		te, ok := err.(*RecordTypeError)
+		if !ok {
+			t.Errorf("%T: expected a *RecordTypeError, but got %v", dst, err)
+		} else if te.Record != int64(-1) || te.Type != reflect.TypeOf(dst).Elem().Elem() {
+			t.Errorf("%T: unexpected error %v", dst, err)
+		}
+		if n := reflect.ValueOf(dst).Elem().Len(); n != 0 {
+			t.Errorf("%T: expected no records, but got %d", dst, n)
+		}
+		sort.Abort()
+	}
+	// records are assignable to interfaces they implement
+	var all []interface{}
+	if err := newSort().ReadAllInto(&all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0] != int64(-1) || all[2] != int64(1<<40) {
+		t.Errorf("unexpected records %v", all)
+	}
+}
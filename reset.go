@@ -0,0 +1,91 @@
+package filesort
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Reset prepares FileSort for sorting a new batch of records with the same
+// options, so they don't have to be specified again. It must only be called
+// after Read has returned nil, or an error if the sort has failed or has been
+// aborted, otherwise it returns an error. Reset removes the remaining
+// temporary files, clears the error, the statistics and the output checksum,
+// and starts a new sort. Note that the deadline set with WithDeadline and the
+// context set with WithContext apply to the new sort as well. Reset must not
+// be called concurrently with other methods.
+func (ps *FileSort) Reset() error {
+	select {
+	case <-ps.done:
+	default:
+		return fmt.Errorf("sort is still in progress")
+	}
+	if len(ps.out) > 0 {
+		return fmt.Errorf("sorted records haven't been read yet")
+	}
+	ps.removeTemp()
+	ps.pagerMu.Lock()
+	if ps.pager != nil {
+		os.RemoveAll(ps.pager.dir)
+		ps.pager = nil
+	}
+	ps.pagerMu.Unlock()
+
+	ps.in = make(chan interface{}, cap(ps.in))
+	ps.out = make(chan output, cap(ps.out))
+	ps.abort = make(chan struct{})
+	ps.abortOnce = sync.Once{}
+	ps.abortErr = nil
+	ps.done = make(chan struct{})
+	ps.ingested = make(chan struct{})
+	ps.err = atomic.Value{}
+	ps.cmpErr = atomic.Value{}
+
+	ps.buffer = nil
+	ps.bufferLen = 0
+	ps.bufferBytes = 0
+	ps.mergeBytes = 0
+	ps.peakBytes = 0
+	ps.files = nil
+	ps.spills = 0
+	ps.keyed = false
+	ps.transitivityChecked = false
+	ps.lastOut = nil
+	ps.monotonicFailed = false
+	ps.pending = nil
+	ps.emittedLast = nil
+	ps.unread = nil
+	ps.outCount = 0
+	ps.lastProgress = 0
+	ps.min, ps.max = nil, nil
+	ps.prev = nil
+	ps.seq = 0
+	ps.stats = Stats{}
+	ps.spillCount = 0
+	ps.spillTotal = 0
+	ps.tempDir = ""
+	if ps.keyCache != nil {
+		ps.keyCache.reset()
+	}
+	if ps.watermark != nil {
+		ps.watermark.items = nil
+		ps.watermark.seq = 0
+		ps.watermark.started = false
+	}
+	if ps.checksum != nil {
+		ps.checksum.Reset()
+		ps.checksumEnc = ps.newEncoder(nopWriteCloser{ps.checksum})
+		ps.checksumSum = 0
+	}
+	if ps.recordTo != nil {
+		ps.recorder = ps.newEncoder(nopWriteCloser{ps.recordTo})
+	}
+	if ps.checkpoint != nil {
+		if err := ps.loadCheckpoint(); err != nil {
+			return err
+		}
+	}
+	ps.start()
+	return nil
+}
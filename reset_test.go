@@ -0,0 +1,62 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithOutputChecksum(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checksum uint64
+	for batch := 0; batch < 3; batch++ {
+		for i := 0; i < 10; i++ {
+			sort.Write(fmt.Sprintf("%d-%d", batch, 9-i))
+		}
+		sort.Close()
+		if batch == 0 {
+			if err := sort.Reset(); err == nil {
+				t.Error("expected an error from Reset before the output has been read")
+			}
+		}
+		for i := 0; i < 10; i++ {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := fmt.Sprintf("%d-%d", batch, i); v != exp {
+				t.Errorf("batch %d: expected %s but got %v", batch, exp, v)
+			}
+		}
+		if v, err := sort.Read(); v != nil || err != nil {
+			t.Fatalf("batch %d: expected end of output but got %v %v", batch, v, err)
+		}
+		if st := sort.Stats(); st.RecordsIn != 10 {
+			t.Errorf("batch %d: expected 10 records in but got %d", batch, st.RecordsIn)
+		}
+		if sort.OutputChecksum() == checksum {
+			t.Errorf("batch %d: expected the checksum to differ from the previous batch", batch)
+		}
+		checksum = sort.OutputChecksum()
+		if err := sort.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Abort()
+	if err := sort.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Write("a")
+	sort.Close()
+	if v, err := sort.Read(); v != "a" || err != nil {
+		t.Errorf("expected a after Reset following Abort, but got %v %v", v, err)
+	}
+}
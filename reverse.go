@@ -0,0 +1,74 @@
+package filesort
+
+// emitReverse reads all the records from the merge reader and emits them in
+// the reverse order. Only the last chunk of up to bufferMax records is kept
+// in memory, the rest of the output is written to temporary files which are
+// then read back in the reverse order.
+func (ps *FileSort) emitReverse(mr Reader) error {
+	var chunks []string
+	defer func() {
+		for _, name := range chunks {
+			ps.removeRun(name)
+		}
+	}()
+	var chunk []interface{}
+	for {
+		next, err := ps.nextMerged(mr)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			break
+		}
+		if len(chunk) >= ps.bufferMax {
+			name, err := ps.writeRun(ps.tempDir, chunk)
+			if name != "" {
+				chunks = append(chunks, name)
+			}
+			if err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+		chunk = append(chunk, next)
+	}
+	for i := len(chunks); i >= 0; i-- {
+		if i < len(chunks) {
+			var err error
+			if chunk, err = ps.readRun(chunks[i], chunk[:0]); err != nil {
+				return err
+			}
+		}
+		for j := len(chunk) - 1; j >= 0; j-- {
+			if err := ps.emit(chunk[j], -1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readRun reads all the records from the file and appends them to records.
+func (ps *FileSort) readRun(name string, records []interface{}) ([]interface{}, error) {
+	return ps.readRecords(name, ps.runDecoder, records)
+}
+
+// readRecords is like readRun, but reads the file with the decoder returned
+// by newDec.
+func (ps *FileSort) readRecords(name string, newDec decoderFunc, records []interface{}) ([]interface{}, error) {
+	fr, err := ps.openFileReader(name, ps.readAheadSize(1), newDec)
+	if err != nil {
+		return records, err
+	}
+	defer fr.Close()
+	for {
+		v, err := fr.Next()
+		if err != nil {
+			return records, err
+		}
+		if v == nil {
+			return records, nil
+		}
+		records = append(records, v)
+	}
+}
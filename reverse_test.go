@@ -0,0 +1,105 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOutputReverse(t *testing.T) {
+	for _, bufSize := range []int{3, 1000} {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(bufSize),
+			WithOutputReverse(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var input []string
+		for i := 0; i < 20; i++ {
+			input = append(input, fmt.Sprintf("%d%02d", (i*3)%5, i))
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		// ascending order is stable, so equal records come in the
+		// insertion order, descending order must be exactly the reverse
+		var ascending []string
+		for k := 0; k < 5; k++ {
+			for _, s := range input {
+				if s[0] == byte('0'+k) {
+					ascending = append(ascending, s)
+				}
+			}
+		}
+		for i := len(ascending) - 1; i >= 0; i-- {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				t.Fatalf("unexpected end of output, expected %s", ascending[i])
+			}
+			if s.(string) != ascending[i] {
+				t.Errorf("expected %s but got %s", ascending[i], s)
+			}
+		}
+		if s, err := sort.Read(); s != nil || err != nil {
+			t.Errorf("expected end of output, but got %v %v", s, err)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[:1] < b.(string)[:1] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithReverse(reverse),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg := sort.Config(); cfg.Reverse != reverse {
+			t.Errorf("expected Reverse %v in config", reverse)
+		}
+		var input []string
+		for i := 0; i < 20; i++ {
+			input = append(input, fmt.Sprintf("%d%02d", (i*3)%5, i))
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		// equal records stay in the insertion order either way
+		var expected []string
+		for k := 0; k < 5; k++ {
+			key := byte('0' + k)
+			if reverse {
+				key = byte('4' - k)
+			}
+			for _, s := range input {
+				if s[0] == key {
+					expected = append(expected, s)
+				}
+			}
+		}
+		for _, exp := range expected {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != exp {
+				t.Errorf("reverse %v: expected %s but got %v", reverse, exp, s)
+			}
+		}
+		if s, err := sort.Read(); s != nil || err != nil {
+			t.Errorf("expected end of output, but got %v %v", s, err)
+		}
+	}
+}
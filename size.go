@@ -0,0 +1,64 @@
+package filesort
+
+import "sync/atomic"
+
+// Sizer is an interface that records can implement to report their
+// approximate size in memory in bytes.
+type Sizer interface {
+	Size() int
+}
+
+// defaultRecordSize is the size assumed for records of unknown types.
+const defaultRecordSize = 64
+
+// recordSize returns the approximate size of the record in memory, using
+// unknown as the size of records of unknown types.
+func recordSize(v interface{}, unknown int64) int64 {
+	switch r := v.(type) {
+	case Sizer:
+		return int64(r.Size())
+	case string:
+		return int64(len(r))
+	case []byte:
+		return int64(len(r))
+	case []string:
+		size := int64(24 * len(r))
+		for _, s := range r {
+			size += int64(len(s))
+		}
+		return size
+	case IndexedRecord:
+		return 8 + recordSize(r.Value, unknown)
+	case keyedRecord:
+		return recordSize(r.key, unknown) + recordSize(r.value, unknown)
+	case encodedRecord:
+		size := int64(len(r.data))
+		if r.value != nil {
+			size += recordSize(r.value, unknown)
+		}
+		return size
+	}
+	return unknown
+}
+
+// updatePeak updates the high-water mark of buffered data if current exceeds
+// it.
+func (ps *FileSort) updatePeak(current int64) {
+	for {
+		peak := atomic.LoadInt64(&ps.peakBytes)
+		if current <= peak || atomic.CompareAndSwapInt64(&ps.peakBytes, peak, current) {
+			return
+		}
+	}
+}
+
+// PeakBufferedBytes returns the high-water mark of the approximate amount of
+// memory taken by records held by FileSort, either in the memory buffer while
+// accepting input or in the memory buffer and as the current records of the
+// spill files during merge. Records implementing Sizer report their own size,
+// the size of strings, byte slices and slices of strings is computed, and
+// for other records a fixed size of 64 bytes, or the one set with
+// WithRecordSizeEstimate, is assumed.
+func (ps *FileSort) PeakBufferedBytes() int64 {
+	return atomic.LoadInt64(&ps.peakBytes)
+}
@@ -0,0 +1,107 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPeakBufferedBytes(t *testing.T) {
+	for _, tc := range []struct {
+		records int
+		peak    int64
+	}{
+		// 3 records in the memory buffer, nothing is spilled
+		{3, 30},
+		// 4 records in the memory buffer, then 3 spill files during merge
+		{12, 40},
+		// 6 spill files and 2 records in the memory buffer during merge
+		{26, 80},
+	} {
+		sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < tc.records; i++ {
+			// every record is 10 bytes long
+			sort.Write(fmt.Sprintf("record%04d", i))
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		if peak := sort.PeakBufferedBytes(); peak != tc.peak {
+			t.Errorf("%d records: expected peak of %d bytes, but got %d", tc.records, tc.peak, peak)
+		}
+	}
+}
+
+func TestMaxMemoryBytes(t *testing.T) {
+	var spills int
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBytes(100),
+		WithSpillWarning(func(n int) { spills = n }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// short records fill the buffer after 10 records and long ones after 2
+	for i := 0; i < 20; i++ {
+		sort.Write(fmt.Sprintf("short%05d", 19-i))
+	}
+	for i := 0; i < 4; i++ {
+		sort.Write(fmt.Sprintf("long%046d", 3-i))
+	}
+	sort.Close()
+	var res []string
+	for {
+		s, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s == nil {
+			break
+		}
+		res = append(res, s.(string))
+	}
+	if len(res) != 24 || res[0] != fmt.Sprintf("long%046d", 0) || res[23] != "short00019" {
+		t.Errorf("unexpected output %v", res)
+	}
+	if spills != 4 {
+		t.Errorf("expected 4 spills but got %d", spills)
+	}
+	if cfg := sort.Config(); cfg.MaxMemoryBytes != 100 {
+		t.Errorf("expected MaxMemoryBytes to be 100 but got %d", cfg.MaxMemoryBytes)
+	}
+}
+
+type testUnsizedRecord struct{ n int }
+
+func TestRecordSizeEstimate(t *testing.T) {
+	sort, err := New(
+		WithLess(func(a, b interface{}) bool { return a.(testUnsizedRecord).n < b.(testUnsizedRecord).n }),
+		WithMaxMemoryBytes(100),
+		WithRecordSizeEstimate(40),
+		WithNoSpill(),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Write(testUnsizedRecord{1})
+	sort.Write(testUnsizedRecord{0})
+	sort.Write(testUnsizedRecord{2})
+	sort.Close()
+	if _, err := sort.Read(); err == nil {
+		t.Error("expected the third record to exceed the memory limit")
+	}
+}
@@ -0,0 +1,52 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSpillWarning(t *testing.T) {
+	for _, tc := range []struct {
+		records int
+		spills  []int
+	}{
+		{records: 3, spills: nil},
+		{records: 4, spills: []int{1}},
+		{records: 10, spills: []int{1, 2}},
+	} {
+		t.Run(fmt.Sprint(tc.records), func(t *testing.T) {
+			var spills []int
+			sort, err := New(
+				WithLess(testLessLine),
+				WithEncoderNew(newTestLineEncoder),
+				WithDecoderNew(newTestLineDecoder),
+				WithMaxMemoryBuffer(4),
+				WithSyncClose(),
+				WithSpillWarning(func(n int) {
+					spills = append(spills, n)
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.records; i++ {
+				sort.Write(fmt.Sprint(i))
+			}
+			if err := sort.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(spills) != fmt.Sprint(tc.spills) {
+				t.Errorf("expected spills %v but got %v", tc.spills, spills)
+			}
+			for {
+				v, err := sort.Read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v == nil {
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package filesort
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains statistics collected by FileSort.
+type Stats struct {
+	// RecordsIn is the number of records written
+	RecordsIn int64
+	// Inversions is the number of times a record was less than the one
+	// written before it. It is 0 for sorted input and RecordsIn-1 for
+	// strictly descending input, so it shows how disordered the input is.
+	Inversions int64
+	// ComparatorTime is the total time spent in the comparison function if
+	// FileSort was created with WithComparatorProfile
+	ComparatorTime time.Duration
+	// SpillMinSize, SpillMaxSize and SpillMeanSize describe the distribution
+	// of the sizes in bytes of the spill files written when the memory
+	// buffer was full. They are 0 if nothing has been spilled. Uneven sizes
+	// point to records of variable size.
+	SpillMinSize  int64
+	SpillMaxSize  int64
+	SpillMeanSize int64
+	// SpillFiles is the number of spill files written when the memory buffer
+	// was full
+	SpillFiles int64
+	// BytesSpilled is the total size in bytes of the files written to the
+	// temporary directory, including the files written by merge passes
+	// before the final merge
+	BytesSpilled int64
+	// MaxBufferUsed is the largest number of records held in the memory
+	// buffer
+	MaxBufferUsed int64
+	// MergePasses is the number of passes merging runs, including the final
+	// merge. Every compaction and every pass reducing the number of runs to
+	// the limit set with WithMaxOpenFiles counts as a pass.
+	MergePasses int64
+	// DecodeErrorsSkipped is the number of decoding errors skipped according
+	// to the policy set with WithDecodeErrorPolicy
+	DecodeErrorsSkipped int64
+}
+
+// Stats returns statistics collected by FileSort so far. It is safe to call
+// it concurrently with other methods.
+func (ps *FileSort) Stats() Stats {
+	st := Stats{
+		RecordsIn:           atomic.LoadInt64(&ps.stats.RecordsIn),
+		Inversions:          atomic.LoadInt64(&ps.stats.Inversions),
+		ComparatorTime:      time.Duration(atomic.LoadInt64((*int64)(&ps.stats.ComparatorTime))),
+		BytesSpilled:        atomic.LoadInt64(&ps.stats.BytesSpilled),
+		MaxBufferUsed:       atomic.LoadInt64(&ps.stats.MaxBufferUsed),
+		MergePasses:         atomic.LoadInt64(&ps.stats.MergePasses),
+		DecodeErrorsSkipped: atomic.LoadInt64(&ps.stats.DecodeErrorsSkipped),
+	}
+	ps.spillSizesMu.Lock()
+	defer ps.spillSizesMu.Unlock()
+	st.SpillFiles = ps.spillCount
+	if ps.spillCount > 0 {
+		st.SpillMinSize = ps.stats.SpillMinSize
+		st.SpillMaxSize = ps.stats.SpillMaxSize
+		st.SpillMeanSize = ps.spillTotal / ps.spillCount
+	}
+	return st
+}
+
+// addSpillSize adds the size of the spill file to the statistics.
+func (ps *FileSort) addSpillSize(size int64) {
+	ps.spillSizesMu.Lock()
+	defer ps.spillSizesMu.Unlock()
+	if ps.spillCount == 0 || size < ps.stats.SpillMinSize {
+		ps.stats.SpillMinSize = size
+	}
+	if size > ps.stats.SpillMaxSize {
+		ps.stats.SpillMaxSize = size
+	}
+	ps.spillCount++
+	ps.spillTotal += size
+}
+
+// updateMaxBuffer updates the largest number of records held in the memory
+// buffer.
+func (ps *FileSort) updateMaxBuffer() {
+	if n := int64(ps.bufferLen); n > atomic.LoadInt64(&ps.stats.MaxBufferUsed) {
+		atomic.StoreInt64(&ps.stats.MaxBufferUsed, n)
+	}
+}
@@ -0,0 +1,212 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStatsInversions(t *testing.T) {
+	inversions := func(input []string) Stats {
+		sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		return sort.Stats()
+	}
+	var sorted, nearly, reversed []string
+	for i := 0; i < 100; i++ {
+		sorted = append(sorted, fmt.Sprintf("%03d", i))
+		reversed = append(reversed, fmt.Sprintf("%03d", 99-i))
+	}
+	nearly = append(nearly, sorted...)
+	nearly[10], nearly[11] = nearly[11], nearly[10]
+	nearly[50], nearly[60] = nearly[60], nearly[50]
+	for _, tc := range []struct {
+		name       string
+		input      []string
+		inversions int64
+	}{
+		{"sorted", sorted, 0},
+		{"nearly sorted", nearly, 3},
+		{"reversed", reversed, 99},
+	} {
+		st := inversions(tc.input)
+		if st.RecordsIn != 100 {
+			t.Errorf("%s: expected 100 records in, but got %d", tc.name, st.RecordsIn)
+		}
+		if st.Inversions != tc.inversions {
+			t.Errorf("%s: expected %d inversions, but got %d", tc.name, tc.inversions, st.Inversions)
+		}
+	}
+}
+
+func TestMaxInversions(t *testing.T) {
+	run := func(input []string) error {
+		sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxInversions(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil || s == nil {
+				return err
+			}
+		}
+	}
+	var nearly, reversed []string
+	for i := 0; i < 100; i++ {
+		nearly = append(nearly, fmt.Sprintf("%03d", i))
+		reversed = append(reversed, fmt.Sprintf("%03d", 99-i))
+	}
+	nearly[10], nearly[11] = nearly[11], nearly[10]
+	nearly[50], nearly[60] = nearly[60], nearly[50]
+	if err := run(nearly); err != nil {
+		t.Errorf("expected nearly sorted input with 3 inversions to pass, but got %v", err)
+	}
+	if err := run(reversed); err == nil {
+		t.Error("expected reversed input to fail")
+	}
+}
+
+func TestComparatorProfile(t *testing.T) {
+	var comparisons int
+	slowLess := func(a, b interface{}) bool {
+		comparisons++
+		for start := time.Now(); time.Since(start) < 20*time.Microsecond; {
+		}
+		return testLessLine(a, b)
+	}
+	profile := func(n int) time.Duration {
+		sort, err := New(WithLess(slowLess), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(10), WithComparatorProfile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			sort.Write(fmt.Sprintf("%03d", (i*37)%n))
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		return sort.Stats().ComparatorTime
+	}
+	small := profile(50)
+	if min := time.Duration(comparisons) * 20 * time.Microsecond; small < min {
+		t.Errorf("expected at least %v spent in %d comparisons, but got %v", min, comparisons, small)
+	}
+	if large := profile(500); large <= small {
+		t.Errorf("expected time for 500 records to be more than %v for 50 records, but got %v", small, large)
+	}
+}
+
+func TestStatsSpillSizes(t *testing.T) {
+	spill := func(input []string) Stats {
+		sort, err := New(WithLess(testLessLine), WithEncoderNew(newTestLineEncoder), WithDecoderNew(newTestLineDecoder), WithMaxMemoryBuffer(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range input {
+			sort.Write(s)
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		return sort.Stats()
+	}
+	var fixed, variable []string
+	for i := 0; i < 20; i++ {
+		// every record takes 11 bytes with the newline
+		fixed = append(fixed, fmt.Sprintf("record%04d", i))
+		variable = append(variable, fmt.Sprintf("%0*d", 1+i*i, i))
+	}
+	if st := spill(fixed); st.SpillMinSize != 44 || st.SpillMaxSize != 44 || st.SpillMeanSize != 44 {
+		t.Errorf("expected all the spill files to be 44 bytes, but got min %d, max %d, mean %d",
+			st.SpillMinSize, st.SpillMaxSize, st.SpillMeanSize)
+	}
+	st := spill(variable)
+	// the first file has records of 1, 2, 5 and 10 bytes and the last one of
+	// 257, 290, 325 and 362 bytes, plus newlines
+	if st.SpillMinSize != 22 || st.SpillMaxSize != 1238 {
+		t.Errorf("expected spill sizes between 22 and 1238 bytes, but got min %d, max %d", st.SpillMinSize, st.SpillMaxSize)
+	}
+	if st.SpillMeanSize <= st.SpillMinSize || st.SpillMeanSize >= st.SpillMaxSize {
+		t.Errorf("expected mean spill size between %d and %d, but got %d", st.SpillMinSize, st.SpillMaxSize, st.SpillMeanSize)
+	}
+	if st := spill(fixed[:3]); st.SpillMinSize != 0 || st.SpillMaxSize != 0 || st.SpillMeanSize != 0 {
+		t.Errorf("expected no spill sizes without spilling, but got %v", st)
+	}
+}
+
+func TestStatsSpillFiles(t *testing.T) {
+	for _, tc := range []struct {
+		maxOpenFiles int
+		bytes        int64
+		passes       int64
+	}{
+		{0, 220, 1},
+		// 5 files are merged into 3 files of 88, 88 and 44 bytes and then
+		// into 2 files of 176 and 44 bytes
+		{2, 220 + 176 + 176, 3},
+	} {
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(4),
+			WithMaxOpenFiles(tc.maxOpenFiles),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			// every record takes 11 bytes with the newline
+			sort.Write(fmt.Sprintf("record%04d", 19-i))
+		}
+		sort.Close()
+		for {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s == nil {
+				break
+			}
+		}
+		st := sort.Stats()
+		if st.RecordsIn != 20 || st.SpillFiles != 5 || st.BytesSpilled != tc.bytes || st.MaxBufferUsed != 4 || st.MergePasses != tc.passes {
+			t.Errorf("max open files %d: expected 20 records, 5 spill files, %d bytes spilled, 4 records in buffer and %d merge passes, but got %+v",
+				tc.maxOpenFiles, tc.bytes, tc.passes, st)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package filesort
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ObjectStore is a storage for spill files, e.g. a bucket in a cloud object
+// storage, that can be used instead of the local disk. Objects are written
+// completely before they are read and are never modified.
+type ObjectStore interface {
+	// Put creates a new object with the given name, the object is
+	// complete after the returned writer has been closed successfully
+	Put(name string) (io.WriteCloser, error)
+	// Get opens the object with the given name for reading
+	Get(name string) (io.ReadCloser, error)
+	// Delete removes the object with the given name
+	Delete(name string) error
+}
+
+// WithObjectStore makes FileSort store spill files in the given ObjectStore
+// instead of the local temporary directory. Names of the objects start with a
+// random prefix unique for every FileSort, so the same store can be shared by
+// several sorts. Objects are deleted when they aren't needed anymore, or by
+// Abort, errors of deleting are ignored. ReadPageFromEnd still uses the local
+// disk.
+func WithObjectStore(store ObjectStore) Option {
+	return func(ps *FileSort) {
+		ps.store = store
+	}
+}
+
+// newStorePrefix returns a random prefix for the names of the objects.
+func newStorePrefix() (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("couldn't generate a prefix for object names: %v", err)
+	}
+	return "filesort-" + hex.EncodeToString(buf[:]) + "/", nil
+}
+
+// countingWriteCloser counts the bytes written to the underlying writer.
+type countingWriteCloser struct {
+	io.WriteCloser
+	n *int64
+}
+
+func (cw countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := cw.WriteCloser.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// openRun opens the spill file or the object with the given name for
+// reading.
+func (ps *FileSort) openRun(name string) (io.ReadCloser, error) {
+	if ps.store != nil {
+		return ps.store.Get(name)
+	}
+	return os.Open(name)
+}
+
+// runSize returns the size of the spill file in bytes.
+func (ps *FileSort) runSize(name string) (int64, error) {
+	if ps.store != nil {
+		ps.storeMu.Lock()
+		size, ok := ps.storeSizes[name]
+		ps.storeMu.Unlock()
+		if !ok {
+			return 0, fmt.Errorf("unknown object %s", name)
+		}
+		return size, nil
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// removeRuns removes all the spill files, including the ones that may have
+// already been removed after they had been read.
+func (ps *FileSort) removeRuns() {
+	for _, name := range ps.files {
+		ps.removeRun(name)
+	}
+	ps.files = nil
+}
+
+// removeTemp removes all the temporary files of the sort.
+func (ps *FileSort) removeTemp() {
+	if ps.store != nil {
+		ps.removeRuns()
+		return
+	}
+	os.RemoveAll(ps.tempDir)
+}
@@ -0,0 +1,167 @@
+package filesort
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testStore is an in-memory ObjectStore.
+type testStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func newTestStore() *testStore {
+	return &testStore{objects: make(map[string][]byte)}
+}
+
+type testStoreWriter struct {
+	bytes.Buffer
+	ts   *testStore
+	name string
+}
+
+func (tw *testStoreWriter) Close() error {
+	tw.ts.mu.Lock()
+	defer tw.ts.mu.Unlock()
+	tw.ts.objects[tw.name] = tw.Bytes()
+	return nil
+}
+
+func (ts *testStore) Put(name string) (io.WriteCloser, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.puts++
+	return &testStoreWriter{ts: ts, name: name}, nil
+}
+
+func (ts *testStore) Get(name string) (io.ReadCloser, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	data, ok := ts.objects[name]
+	if !ok {
+		return nil, fmt.Errorf("object %s doesn't exist", name)
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ts *testStore) Delete(name string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, ok := ts.objects[name]; !ok {
+		return fmt.Errorf("object %s doesn't exist", name)
+	}
+	delete(ts.objects, name)
+	return nil
+}
+
+func (ts *testStore) names() []string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var names []string
+	for name := range ts.objects {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestObjectStore(t *testing.T) {
+	for _, index := range []bool{false, true} {
+		store := newTestStore()
+		// the transform blocks the merge, so the spill files can be checked
+		unblock := make(chan struct{})
+		opts := []Option{
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(3),
+			WithCompactThreshold(3),
+			WithSyncClose(),
+			WithObjectStore(store),
+			WithOutputTransform(func(v interface{}) (interface{}, error) {
+				<-unblock
+				return v, nil
+			}),
+		}
+		if index {
+			opts = append(opts, WithIndex())
+		}
+		sort, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			sort.Write(fmt.Sprintf("%02d", (i*7)%20))
+		}
+		if err := sort.Close(); err != nil {
+			close(unblock)
+			t.Fatal(err)
+		}
+		names := store.names()
+		close(unblock)
+		if _, err := os.Stat(sort.tempDir); !os.IsNotExist(err) {
+			t.Errorf("expected no local temporary directory, but got %v", err)
+		}
+		if len(names) == 0 {
+			t.Fatal("expected spill files in the store")
+		}
+		for _, name := range names {
+			if !strings.HasPrefix(name, sort.tempDir) {
+				t.Errorf("object %s doesn't have prefix %s", name, sort.tempDir)
+			}
+		}
+		for i := 0; i < 20; i++ {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index {
+				v = v.(IndexedRecord).Value
+			}
+			if exp := fmt.Sprintf("%02d", i); v != exp {
+				t.Errorf("expected %s but got %v", exp, v)
+			}
+		}
+		if v, err := sort.Read(); v != nil || err != nil {
+			t.Fatalf("expected the end of the stream, but got %v %v", v, err)
+		}
+		if names := store.names(); len(names) != 0 {
+			t.Errorf("expected the store to be empty after the sort, but got %v", names)
+		}
+		if store.puts < 6 {
+			t.Errorf("expected at least 6 objects to be written, but got %d", store.puts)
+		}
+	}
+}
+
+func TestObjectStoreAbort(t *testing.T) {
+	store := newTestStore()
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithObjectStore(store),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Abort()
+	if names := store.names(); len(names) != 0 {
+		t.Errorf("expected the store to be empty after Abort, but got %v", names)
+	}
+}
@@ -0,0 +1,158 @@
+package filesort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithTempDir(dir),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := sort.Config(); cfg.TempDir != dir {
+		t.Errorf("expected TempDir %s in config, but got %s", dir, cfg.TempDir)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(9 - i))
+	}
+	if err := sort.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(sort.tempDir) != dir {
+		t.Errorf("expected spill files in %s, but they are in %s", dir, sort.tempDir)
+	}
+	for i := 0; i < 10; i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != fmt.Sprint(i) {
+			t.Errorf("expected %d but got %v", i, v)
+		}
+	}
+}
+
+func TestTempDirFailedClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return &testFailOnEncoder{newTestLineEncoder(w), "fail"} }),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithSyncClose(),
+		WithTempDir(dir),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a few runs are spilled before the one with the failing record
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(9 - i))
+	}
+	sort.Write("fail")
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprint(i))
+	}
+	if err := sort.Close(); err == nil {
+		t.Fatal("expected Close to fail")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected the temporary directory to be empty, but it contains %d files", len(files))
+	}
+	sort.Abort()
+}
+
+// testFailOnEncoder fails to encode the given record.
+type testFailOnEncoder struct {
+	Encoder
+	fail string
+}
+
+func (fe *testFailOnEncoder) Encode(v interface{}) error {
+	if v == fe.fail {
+		return errors.New("encoding failed")
+	}
+	return fe.Encoder.Encode(v)
+}
+
+func TestTempDirInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		dir string
+		err string
+	}{
+		{filepath.Join(dir, "missing"), "couldn't access"},
+		{file, "not a directory"},
+	} {
+		_, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithTempDir(tc.dir),
+		)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected error containing %q, but got %v", tc.dir, tc.err, err)
+		}
+	}
+}
+
+func TestTempDirCreateError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	t.Setenv("TMPDIR", filepath.Join(dir, "missing"))
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the error is reported before the input is closed
+	if v, err := sort.Read(); err == nil || !strings.Contains(err.Error(), "couldn't create temporary directory") {
+		t.Errorf("expected temporary directory error, but got %v %v", v, err)
+	}
+	if err := sort.Write("a"); err == nil {
+		t.Error("expected Write to fail")
+	}
+	sort.Close()
+	<-sort.done
+}
@@ -0,0 +1,59 @@
+package text
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	filesort "gitlab.com/shaydo/go-filesort"
+)
+
+// SortReader reads LF separated lines from in, sorts them and writes them to
+// out, every line terminated with LF, including the last one if it was
+// missing in the input. Lines are sorted with Less unless opts contain
+// another comparison function, opts are applied after the defaults.
+func SortReader(in io.Reader, out io.Writer, opts ...filesort.Option) error {
+	sort, err := filesort.New(append([]filesort.Option{
+		filesort.WithLess(Less),
+		filesort.WithEncoderNew(NewEncoder),
+		filesort.WithDecoderNew(NewDecoder),
+	}, opts...)...)
+	if err != nil {
+		return err
+	}
+	// stop the sort and remove its temporary files on every return
+	defer sort.Abort()
+	bin := bufio.NewReader(in)
+	for {
+		line, err := bin.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("couldn't read a line: %v", err)
+		}
+		if line != "" {
+			if err := sort.Write(strings.TrimSuffix(line, "\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := sort.Close(); err != nil {
+		return err
+	}
+	bout := bufio.NewWriter(out)
+	for {
+		line, err := sort.Read()
+		if err != nil {
+			return err
+		}
+		if line == nil {
+			break
+		}
+		if _, err := bout.WriteString(line.(string) + "\n"); err != nil {
+			return fmt.Errorf("couldn't write a line: %v", err)
+		}
+	}
+	return bout.Flush()
+}
@@ -16,6 +16,29 @@ func Less(a, b interface{}) bool {
 	return a.(string) < b.(string)
 }
 
+// LessPrefix returns a function that compares only the first n bytes of two
+// strings, which is cheaper for long strings when only their beginning
+// matters for the order. Strings with the same prefix are considered equal
+// and stay in the order they have been written, unless fullOnTie is true, in
+// which case such strings are compared in full. Either way the order is
+// consistent with Less as far as the prefixes differ.
+func LessPrefix(n int, fullOnTie bool) filesort.Less {
+	return func(a, b interface{}) bool {
+		sa, sb := a.(string), b.(string)
+		pa, pb := sa, sb
+		if len(pa) > n {
+			pa = pa[:n]
+		}
+		if len(pb) > n {
+			pb = pb[:n]
+		}
+		if pa != pb || !fullOnTie {
+			return pa < pb
+		}
+		return sa < sb
+	}
+}
+
 type textEncoder struct {
 	w io.WriteCloser
 }
@@ -23,6 +46,8 @@ type textEncoder struct {
 // NewEncoder returns filesort.Encoder that encodes strings for storing into
 // file by simply separating them with newlines. Sorted strings must not
 // contain LF character, otherwise the data will be corrupted on decoding.
+// Together with filesort.WithPlainTextSpill and Less, spill files are plain
+// sorted text that can be merged with "LC_ALL=C sort -m".
 func NewEncoder(w io.WriteCloser) filesort.Encoder {
 	return &textEncoder{w: w}
 }
@@ -41,9 +66,14 @@ type textDecoder struct {
 }
 
 // NewDecoder returns filesort.Decoder that reads LF separated strings from
-// the input.
+// the input. If r is a *bufio.Reader, the decoder reads from it directly
+// instead of adding a buffer of its own.
 func NewDecoder(r io.Reader) filesort.Decoder {
-	return &textDecoder{r: bufio.NewReader(r)}
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &textDecoder{r: br}
 }
 
 func (td *textDecoder) Decode() (interface{}, error) {
@@ -1,8 +1,14 @@
 package text
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	filesort "gitlab.com/shaydo/go-filesort"
 )
@@ -91,3 +97,90 @@ func TestTextSort(t *testing.T) {
 		t.Errorf("expected EOF, but got: %v %v", s, err)
 	}
 }
+
+func TestLessPrefix(t *testing.T) {
+	input := []string{"abcz", "abd", "abca", "ab", "aa"}
+	for _, tc := range []struct {
+		fullOnTie bool
+		expected  []string
+	}{
+		{false, []string{"aa", "ab", "abcz", "abca", "abd"}},
+		{true, []string{"aa", "ab", "abca", "abcz", "abd"}},
+	} {
+		sort, err := filesort.New(
+			filesort.WithLess(LessPrefix(3, tc.fullOnTie)),
+			filesort.WithEncoderNew(NewEncoder),
+			filesort.WithDecoderNew(NewDecoder),
+			filesort.WithMaxMemoryBuffer(2),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, str := range input {
+			sort.Write(str)
+		}
+		sort.Close()
+		for _, str := range tc.expected {
+			s, err := sort.Read()
+			if err != nil {
+				t.Fatalf("couldn't read: %v", err)
+			}
+			if s.(string) != str {
+				t.Errorf("fullOnTie=%v: expected %s but got %s", tc.fullOnTie, str, s)
+			}
+		}
+	}
+}
+
+func TestSortReader(t *testing.T) {
+	for in, exp := range map[string]string{
+		"":                 "",
+		"b\nc\na\n":        "a\nb\nc\n",
+		"b\nc\na":          "a\nb\nc\n",
+		"d\n\nb\na\nc\n\n": "\n\na\nb\nc\nd\n",
+	} {
+		var out strings.Builder
+		if err := SortReader(strings.NewReader(in), &out, filesort.WithMaxMemoryBuffer(2)); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != exp {
+			t.Errorf("expected %q for %q, but got %q", exp, in, out.String())
+		}
+	}
+}
+
+type testFailingDecoder struct{}
+
+func (testFailingDecoder) Decode() (interface{}, error) { return nil, errors.New("decoding failed") }
+
+func TestSortReaderError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesort-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	input := "d\nb\na\nc\ne\n"
+	for _, tc := range []struct {
+		name string
+		in   io.Reader
+		opts []filesort.Option
+	}{
+		{"input", io.MultiReader(strings.NewReader(input), iotest.ErrReader(errors.New("reading failed"))), nil},
+		{"output", strings.NewReader(input), []filesort.Option{
+			filesort.WithDecoderNew(func(io.Reader) filesort.Decoder { return testFailingDecoder{} }),
+		}},
+	} {
+		var out strings.Builder
+		opts := append([]filesort.Option{filesort.WithMaxMemoryBuffer(2), filesort.WithTempDir(dir)}, tc.opts...)
+		if err := SortReader(tc.in, &out, opts...); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 0 {
+			t.Errorf("%s: expected the temporary directory to be empty, but it contains %d files", tc.name, len(files))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package filesort
+
+import (
+	"bytes"
+	"hash/fnv"
+)
+
+// WithHashTieBreak makes FileSort order records that are equal according to
+// the comparison function by the FNV-1a hash of their form encoded with the
+// configured Encoder, and by the encoded form itself if the hashes are equal
+// too. The output is then deterministic, i.e. it doesn't depend on the order
+// the records have been written in, without keeping their indices, but
+// unlike the default stable order it doesn't preserve the insertion order of
+// equal records. Records are encoded on every comparison that ends in a tie,
+// which is expensive if there are many ties. It has no effect with
+// WithEncodedComparison, which already compares the encoded forms.
+func WithHashTieBreak() Option {
+	return func(ps *FileSort) {
+		ps.hashTieBreak = true
+	}
+}
+
+// lessTieBreak returns a comparison function that breaks ties of less by the
+// hashes of the encoded records.
+func (ps *FileSort) lessTieBreak(less func(a, b interface{}) bool) func(a, b interface{}) bool {
+	return func(a, b interface{}) bool {
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		ea, err := ps.tieBreakForm(a)
+		if err != nil {
+			return false
+		}
+		eb, err := ps.tieBreakForm(b)
+		if err != nil {
+			return false
+		}
+		ha, hb := fnv.New64a(), fnv.New64a()
+		ha.Write(ea)
+		hb.Write(eb)
+		if sa, sb := ha.Sum64(), hb.Sum64(); sa != sb {
+			return sa < sb
+		}
+		return bytes.Compare(ea, eb) < 0
+	}
+}
+
+// tieBreakForm returns the encoded form of the record or of the value of the
+// record written with WriteWithKey. If the record can't be encoded, the
+// error is reported as a comparison error.
+func (ps *FileSort) tieBreakForm(v interface{}) ([]byte, error) {
+	if kr, ok := v.(keyedRecord); ok {
+		v = kr.value
+	}
+	er, err := ps.encodeRecord(v)
+	if err != nil {
+		ps.setCompareErr(err)
+		return nil, err
+	}
+	return er.data, nil
+}
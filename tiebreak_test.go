@@ -0,0 +1,53 @@
+package filesort
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestHashTieBreak(t *testing.T) {
+	run := func(step int) []string {
+		sort, err := New(
+			WithLess(func(a, b interface{}) bool { return a.(string)[0] < b.(string)[0] }),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(7),
+			WithHashTieBreak(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// only the first character is compared, so there are many ties
+		for i := 0; i < 50; i++ {
+			n := (i * step) % 50
+			sort.Write(fmt.Sprintf("%c%02d", 'a'+n%3, n))
+		}
+		sort.Close()
+		var res []string
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v == nil {
+				return res
+			}
+			res = append(res, v.(string))
+		}
+	}
+	first := run(1)
+	if len(first) != 50 {
+		t.Fatalf("expected 50 records but got %d", len(first))
+	}
+	for i := 1; i < len(first); i++ {
+		if first[i][0] < first[i-1][0] {
+			t.Fatalf("output is not sorted: %v", first)
+		}
+	}
+	for _, step := range []int{7, 13, 49} {
+		if res := run(step); !reflect.DeepEqual(res, first) {
+			t.Errorf("output for input order %d differs: %v and %v", step, res, first)
+		}
+	}
+}
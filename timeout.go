@@ -0,0 +1,97 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// readWatchdog interrupts reads from spill files that take longer than
+// timeout. A single timer serves all the readers of the merge: it is reset
+// before every read and stopped after it, and if it fires, the spill file
+// being read is closed, so the read returns.
+type readWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	mu      sync.Mutex
+	// reading is the reader being read and deadline is when its read times
+	// out
+	reading  *timeoutReader
+	deadline time.Time
+}
+
+func newReadWatchdog(timeout time.Duration) *readWatchdog {
+	wd := &readWatchdog{timeout: timeout}
+	wd.timer = time.AfterFunc(timeout, wd.expire)
+	wd.timer.Stop()
+	return wd
+}
+
+// start starts timing the read from tr.
+func (wd *readWatchdog) start(tr *timeoutReader) {
+	wd.mu.Lock()
+	wd.reading = tr
+	wd.deadline = time.Now().Add(wd.timeout)
+	wd.mu.Unlock()
+	wd.timer.Reset(wd.timeout)
+}
+
+// finish stops timing the read started last and reports whether it has timed
+// out.
+func (wd *readWatchdog) finish() bool {
+	wd.timer.Stop()
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	tr := wd.reading
+	wd.reading = nil
+	return tr.timedOut
+}
+
+// stop stops the timer, so the watchdog can be discarded.
+func (wd *readWatchdog) stop() {
+	wd.timer.Stop()
+}
+
+func (wd *readWatchdog) expire() {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+	// the timer may fire for a read that has already finished, when it is
+	// being reset for the next one
+	tr := wd.reading
+	if tr == nil || tr.timedOut || time.Now().Before(wd.deadline) {
+		return
+	}
+	tr.timedOut = true
+	tr.file.Close()
+}
+
+// timeoutReader reads from the spill file and fails if reading the next
+// record takes longer than the timeout of the watchdog.
+type timeoutReader struct {
+	fr   *fileReader
+	name string
+	wd   *readWatchdog
+	// file is the spill file of fr, which the watchdog closes to interrupt
+	// a stalled read
+	file io.Closer
+	// timedOut is set by the watchdog under its lock
+	timedOut bool
+}
+
+func (tr *timeoutReader) Next() (interface{}, error) {
+	if tr.timedOut {
+		return nil, fmt.Errorf("run %s has stalled", tr.name)
+	}
+	tr.wd.start(tr)
+	v, err := tr.fr.Next()
+	if tr.wd.finish() {
+		return nil, fmt.Errorf("reading from run %s has timed out after %v", tr.name, tr.wd.timeout)
+	}
+	return v, err
+}
+
+// Close closes the spill file.
+func (tr *timeoutReader) Close() error {
+	return tr.fr.Close()
+}
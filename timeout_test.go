@@ -0,0 +1,139 @@
+package filesort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSlowDecoder struct {
+	Decoder
+	delay time.Duration
+}
+
+func (sd *testSlowDecoder) Decode() (interface{}, error) {
+	time.Sleep(sd.delay)
+	return sd.Decoder.Decode()
+}
+
+func TestReaderTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		delay   time.Duration
+		timeout bool
+	}{
+		{0, false},
+		{200 * time.Millisecond, true},
+	} {
+		delay := tc.delay
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(func(r io.Reader) Decoder { return &testSlowDecoder{newTestLineDecoder(r), delay} }),
+			WithMaxMemoryBuffer(3),
+			WithReaderTimeout(20*time.Millisecond),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			sort.Write(fmt.Sprintf("%d", 9-i))
+		}
+		sort.Close()
+		var n int
+		for {
+			v, err := sort.Read()
+			if err != nil {
+				if !tc.timeout {
+					t.Fatal(err)
+				}
+				if !strings.Contains(err.Error(), "timed out") {
+					t.Errorf("expected timeout error, but got %v", err)
+				}
+				break
+			}
+			if v == nil {
+				if tc.timeout {
+					t.Error("expected timeout error, but got EOF")
+				}
+				break
+			}
+			n++
+		}
+		if !tc.timeout && n != 10 {
+			t.Errorf("expected 10 records, but got %d", n)
+		}
+	}
+}
+
+// testHangingStore is an ObjectStore whose objects, except for the first one
+// read, hang when they are read till they are closed.
+type testHangingStore struct {
+	*testStore
+	gets int
+}
+
+type testHangingReader struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (hr *testHangingReader) Read(p []byte) (int, error) {
+	<-hr.closed
+	return 0, errors.New("read from a closed object")
+}
+
+func (hr *testHangingReader) Close() error {
+	hr.closeOnce.Do(func() { close(hr.closed) })
+	return nil
+}
+
+func (hs *testHangingStore) Get(name string) (io.ReadCloser, error) {
+	hs.mu.Lock()
+	hs.gets++
+	first := hs.gets == 1
+	hs.mu.Unlock()
+	if first {
+		return hs.testStore.Get(name)
+	}
+	return &testHangingReader{closed: make(chan struct{})}, nil
+}
+
+func TestReaderTimeoutInterrupt(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		WithObjectStore(&testHangingStore{testStore: newTestStore()}),
+		WithReaderTimeout(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sort.Write(fmt.Sprintf("%d", 9-i))
+	}
+	sort.Close()
+	done := make(chan error, 1)
+	go func() {
+		for {
+			v, err := sort.Read()
+			if err != nil || v == nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected timeout error, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stalled read hasn't been interrupted")
+	}
+}
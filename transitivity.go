@@ -0,0 +1,37 @@
+package filesort
+
+import "fmt"
+
+// checkTransitivity checks the comparison function on random triples of
+// records and returns an error if for some records a < b and b < c, but not
+// a < c, or if a is equal to b and b is equal to c, but a isn't equal to c.
+func (ps *FileSort) checkTransitivity(records []interface{}) error {
+	if len(records) < 3 {
+		return nil
+	}
+	for i := 0; i < ps.transitivitySample; i++ {
+		t := [3]interface{}{
+			records[ps.rand.Intn(len(records))],
+			records[ps.rand.Intn(len(records))],
+			records[ps.rand.Intn(len(records))],
+		}
+		for _, p := range [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}} {
+			a, b, c := t[p[0]], t[p[1]], t[p[2]]
+			if ps.less(a, b) && ps.less(b, c) && !ps.less(a, c) {
+				return fmt.Errorf("comparison function isn't transitive: %v < %v and %v < %v, but not %v < %v", a, b, b, c, a, c)
+			}
+			if ps.equal(a, b) && ps.equal(b, c) && !ps.equal(a, c) {
+				return fmt.Errorf("equality of records isn't transitive: %v = %v and %v = %v, but not %v = %v", a, b, b, c, a, c)
+			}
+		}
+		if err := ps.compareErr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// equal returns true if neither of the records comes before the other one.
+func (ps *FileSort) equal(a, b interface{}) bool {
+	return !ps.less(a, b) && !ps.less(b, a)
+}
@@ -0,0 +1,44 @@
+package filesort
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransitivityCheck(t *testing.T) {
+	// rock-paper-scissors
+	beats := map[string]string{"p": "r", "s": "p", "r": "s"}
+	newSort := func(less func(a, b interface{}) bool) *FileSort {
+		sort, err := New(
+			WithLess(less),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithRandSeed(1),
+			WithTransitivityCheck(100),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"r", "p", "s", "r", "p", "s"} {
+			sort.Write(s)
+		}
+		sort.Close()
+		return sort
+	}
+
+	sort := newSort(func(a, b interface{}) bool { return beats[b.(string)] == a.(string) })
+	if v, err := sort.Read(); err == nil || !strings.Contains(err.Error(), "isn't transitive") {
+		t.Errorf("expected transitivity error, but got %v %v", v, err)
+	}
+
+	sort = newSort(testLessLine)
+	for _, exp := range []string{"p", "p", "r", "r", "s", "s"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %s but got %v", exp, v)
+		}
+	}
+}
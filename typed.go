@@ -0,0 +1,114 @@
+package filesort
+
+import (
+	"fmt"
+	"io"
+)
+
+// TypedEncoder is an Encoder for records of type T.
+type TypedEncoder[T any] interface {
+	// Encode encodes the argument and writes it out
+	Encode(v T) error
+	// Close flushes buffers and closes the output handler
+	Close() error
+}
+
+// TypedDecoder is a Decoder for records of type T.
+type TypedDecoder[T any] interface {
+	// Decode decodes the next record. It returns io.EOF in the end of the
+	// stream.
+	Decode() (T, error)
+}
+
+// Sorter is a typed wrapper around FileSort sorting records of type T, so
+// that the records don't have to be converted from interface{}.
+type Sorter[T any] struct {
+	fs *FileSort
+}
+
+// NewSorter creates a new Sorter that orders records using less and encodes
+// them for spilling with encoders returned by newEncoder and decoders returned
+// by newDecoder. Other options are applied to the underlying FileSort. Options
+// that change the type of the output records, such as WithIndex, or that
+// replace the comparison function or the encoders can't be used.
+func NewSorter[T any](less func(a, b T) bool, newEncoder func(w io.WriteCloser) TypedEncoder[T], newDecoder func(r io.Reader) TypedDecoder[T], opts ...Option) (*Sorter[T], error) {
+	if less == nil || newEncoder == nil || newDecoder == nil {
+		return nil, fmt.Errorf("less, decoder and encoder constructors are required")
+	}
+	opts = append(opts,
+		WithLess(func(a, b interface{}) bool { return less(a.(T), b.(T)) }),
+		WithEncoderNew(func(w io.WriteCloser) Encoder { return typedEncoder[T]{newEncoder(w)} }),
+		WithDecoderNew(func(r io.Reader) Decoder { return typedDecoder[T]{newDecoder(r)} }),
+	)
+	fs, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Sorter[T]{fs: fs}, nil
+}
+
+// FileSort returns the underlying FileSort, e.g. to get its statistics.
+func (s *Sorter[T]) FileSort() *FileSort { return s.fs }
+
+// Write writes a record for sorting.
+func (s *Sorter[T]) Write(v T) error {
+	return s.fs.Write(v)
+}
+
+// Close closes the input, after that sorted records can be read.
+func (s *Sorter[T]) Close() error {
+	return s.fs.Close()
+}
+
+// Read returns the next sorted record and true, or the zero value and false
+// in the end of the stream. Like FileSort.Read, it blocks till the input has
+// been closed.
+func (s *Sorter[T]) Read() (T, bool, error) {
+	var zero T
+	v, ok, err := s.fs.ReadOK()
+	if err != nil || !ok {
+		return zero, false, err
+	}
+	if v == nil {
+		// the nil value of an interface type
+		return zero, true, nil
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, false, fmt.Errorf("record of type %T is not of the sorted type %T", v, zero)
+	}
+	return t, true, nil
+}
+
+// Abort aborts sorting and removes temporary files.
+func (s *Sorter[T]) Abort() {
+	s.fs.Abort()
+}
+
+type typedEncoder[T any] struct {
+	enc TypedEncoder[T]
+}
+
+func (te typedEncoder[T]) Encode(v interface{}) error {
+	t, ok := v.(T)
+	if !ok {
+		return fmt.Errorf("record of type %T is not of the sorted type", v)
+	}
+	return te.enc.Encode(t)
+}
+
+func (te typedEncoder[T]) Close() error {
+	return te.enc.Close()
+}
+
+type typedDecoder[T any] struct {
+	dec TypedDecoder[T]
+}
+
+func (td typedDecoder[T]) Decode() (interface{}, error) {
+	v, err := td.dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,103 @@
+package filesort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+type testPoint struct {
+	X, Y int
+}
+
+type testPointEncoder struct {
+	w io.WriteCloser
+}
+
+func (pe testPointEncoder) Encode(p testPoint) error {
+	_, err := fmt.Fprintf(pe.w, "%d %d\n", p.X, p.Y)
+	return err
+}
+
+func (pe testPointEncoder) Close() error {
+	return pe.w.Close()
+}
+
+type testPointDecoder struct {
+	r *bufio.Reader
+}
+
+func (pd testPointDecoder) Decode() (testPoint, error) {
+	var p testPoint
+	_, err := fmt.Fscanf(pd.r, "%d %d\n", &p.X, &p.Y)
+	return p, err
+}
+
+func TestSorter(t *testing.T) {
+	sort, err := NewSorter(
+		func(a, b testPoint) bool { return a.X < b.X },
+		func(w io.WriteCloser) TypedEncoder[testPoint] { return testPointEncoder{w} },
+		func(r io.Reader) TypedDecoder[testPoint] { return testPointDecoder{bufio.NewReader(r)} },
+		WithMaxMemoryBuffer(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := sort.Write(testPoint{X: (i * 7) % 20, Y: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sort.Close()
+	for i := 0; i < 20; i++ {
+		p, ok, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || p.X != i || (p.Y*7)%20 != i {
+			t.Fatalf("expected point with X=%d but got %v %v", i, p, ok)
+		}
+	}
+	if p, ok, err := sort.Read(); ok || err != nil {
+		t.Errorf("expected end of output but got %v %v %v", p, ok, err)
+	}
+	if n := sort.FileSort().Stats().RecordsIn; n != 20 {
+		t.Errorf("expected 20 records written but got %d", n)
+	}
+}
+
+func TestSorterNilRecord(t *testing.T) {
+	// the records are sorted in memory, so they are never encoded
+	sort, err := NewSorter(
+		func(a, b fmt.Stringer) bool { return a.(time.Duration) < b.(time.Duration) },
+		func(w io.WriteCloser) TypedEncoder[fmt.Stringer] { return nil },
+		func(r io.Reader) TypedDecoder[fmt.Stringer] { return nil },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the record with the key 2 has the nil value
+	for _, d := range []time.Duration{3, 1, 2} {
+		var value fmt.Stringer
+		if d != 2 {
+			value = d
+		}
+		sort.FileSort().WriteWithKey(d, value)
+	}
+	sort.Close()
+	// the nil record doesn't end the output
+	for _, exp := range []fmt.Stringer{time.Duration(1), nil, time.Duration(3)} {
+		v, ok, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || v != exp {
+			t.Fatalf("expected %v but got %v %v", exp, v, ok)
+		}
+	}
+	if v, ok, err := sort.Read(); ok || err != nil {
+		t.Errorf("expected end of output but got %v %v %v", v, ok, err)
+	}
+}
@@ -0,0 +1,75 @@
+package filesort
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdjacentUnique(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithMaxMemoryBuffer(3),
+		// records are sorted by the whole string, but equal if their first
+		// letters are equal
+		WithAdjacentUnique(func(a, b interface{}) bool {
+			return a.(string)[0] == b.(string)[0]
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"b2", "a3", "c1", "a1", "b1", "a2", "d1", "b1"} {
+		sort.Write(s)
+	}
+	sort.Close()
+	for _, exp := range []string{"a1", "b1", "c1", "d1"} {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != exp {
+			t.Errorf("expected %s but got %v", exp, v)
+		}
+	}
+	if v, err := sort.Read(); v != nil || err != nil {
+		t.Errorf("expected the end of the stream, but got %v %v", v, err)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	for _, eq := range []func(a, b interface{}) bool{nil, func(a, b interface{}) bool { return a == b }} {
+		sort, err := New(
+			WithLess(testLessLine),
+			WithEncoderNew(newTestLineEncoder),
+			WithDecoderNew(newTestLineDecoder),
+			WithMaxMemoryBuffer(4),
+			WithUnique(eq),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sort.Config().Unique {
+			t.Error("expected Unique in config")
+		}
+		// every record is written 10 times, the copies end up in different
+		// spill files
+		for i := 0; i < 100; i++ {
+			sort.Write(fmt.Sprint((i * 3) % 10))
+		}
+		sort.Close()
+		for i := 0; i < 10; i++ {
+			v, err := sort.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != fmt.Sprint(i) {
+				t.Errorf("expected %d but got %v", i, v)
+			}
+		}
+		if v, err := sort.Read(); v != nil || err != nil {
+			t.Errorf("expected end of output, but got %v %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package filesort
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// WithWatermark makes FileSort sort a stream of events that arrive mostly in
+// order of their event time, returned by extract, but can be late by up to
+// maxLateness. The watermark is the largest event time seen so far minus
+// maxLateness. Records with event time before the watermark are output as
+// soon as the watermark passes them, so only the records within the lateness
+// window are held in memory and nothing is spilled to disk. Records are
+// output in order of their event time, and records with the same event time
+// are ordered by the comparison function. A record that arrives with event
+// time before the watermark is too late to be sorted, it is passed to the
+// function set with WithLateRecords, or the sort fails if there is none.
+// Since records are output while they are being written, the output should be
+// read concurrently with writing, otherwise Write blocks once the output
+// channel is full, which happens after a few thousand records. It can't be
+// used with WithMonotonicKeys or WithOutputReverse.
+func WithWatermark(extract func(v interface{}) int64, maxLateness int64) Option {
+	return func(ps *FileSort) {
+		ps.watermark = &watermark{extract: extract, lateness: maxLateness}
+	}
+}
+
+// WithLateRecords specifies the function that gets the records that arrived
+// too late with WithWatermark. It is called from the sorting goroutine.
+func WithLateRecords(fn func(v interface{})) Option {
+	return func(ps *FileSort) {
+		ps.lateRecords = fn
+	}
+}
+
+// watermark holds the records within the lateness window.
+type watermark struct {
+	extract  func(v interface{}) int64
+	lateness int64
+	less     func(a, b interface{}) bool
+	items    []watermarkItem
+	seq      int64
+	started  bool
+	maxTime  int64
+}
+
+type watermarkItem struct {
+	v    interface{}
+	time int64
+	seq  int64
+}
+
+func (w *watermark) Len() int { return len(w.items) }
+
+// Less orders records by event time, then by the comparison function, and
+// then by the order they have been written, so the output is stable.
+func (w *watermark) Less(i, j int) bool {
+	a, b := &w.items[i], &w.items[j]
+	if a.time != b.time {
+		return a.time < b.time
+	}
+	if w.less(a.v, b.v) {
+		return true
+	}
+	if w.less(b.v, a.v) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (w *watermark) Swap(i, j int) { w.items[i], w.items[j] = w.items[j], w.items[i] }
+
+func (w *watermark) Push(x interface{}) { w.items = append(w.items, x.(watermarkItem)) }
+
+func (w *watermark) Pop() interface{} {
+	n := len(w.items) - 1
+	item := w.items[n]
+	w.items[n] = watermarkItem{}
+	w.items = w.items[:n]
+	return item
+}
+
+// addWatermark adds the record to the lateness window and outputs the
+// records that the watermark has passed. orig is the record as it has been
+// written and v is the record as it is compared.
+func (ps *FileSort) addWatermark(orig, v interface{}) error {
+	w := ps.watermark
+	t := w.extract(orig)
+	if w.started && t < w.maxTime-w.lateness {
+		if ps.lateRecords == nil {
+			return fmt.Errorf("record with event time %d is behind the watermark %d", t, w.maxTime-w.lateness)
+		}
+		ps.lateRecords(orig)
+		return nil
+	}
+	if !w.started || t > w.maxTime {
+		w.started = true
+		w.maxTime = t
+	}
+	heap.Push(w, watermarkItem{v: v, time: t, seq: w.seq})
+	w.seq++
+	for len(w.items) > 0 && w.items[0].time < w.maxTime-w.lateness {
+		if err := ps.emit(heap.Pop(w).(watermarkItem).v, -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushWatermark outputs all the records left in the lateness window in the
+// end of the input.
+func (ps *FileSort) flushWatermark() error {
+	w := ps.watermark
+	for len(w.items) > 0 {
+		if err := ps.emit(heap.Pop(w).(watermarkItem).v, -1); err != nil {
+			return err
+		}
+	}
+	return ps.compareErr()
+}
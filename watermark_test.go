@@ -0,0 +1,142 @@
+package filesort
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEventTime(v interface{}) int64 {
+	t, _ := strconv.ParseInt(strings.SplitN(v.(string), "-", 2)[0], 10, 64)
+	return t
+}
+
+func TestWatermark(t *testing.T) {
+	var late []interface{}
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithWatermark(testEventTime, 5),
+		WithLateRecords(func(v interface{}) { late = append(late, v) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, time := range []int{1, 3, 2, 8, 6, 10, 4, 12, 9, 6, 15, 3} {
+		if err := sort.Write(fmt.Sprintf("%02d-event", time)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the watermark is at 10 now, so the earlier events are output before
+	// the input is closed
+	var res []string
+	for i := 0; i < 6; i++ {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, v.(string))
+	}
+	sort.Close()
+	for {
+		v, err := sort.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v == nil {
+			break
+		}
+		res = append(res, v.(string))
+	}
+	var exp []string
+	for _, time := range []int{1, 2, 3, 6, 8, 9, 10, 12, 15} {
+		exp = append(exp, fmt.Sprintf("%02d-event", time))
+	}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("expected output %v but got %v", exp, res)
+	}
+	if expLate := []interface{}{"04-event", "06-event", "03-event"}; !reflect.DeepEqual(late, expLate) {
+		t.Errorf("expected late records %v but got %v", expLate, late)
+	}
+}
+
+func TestWatermarkConcurrentRead(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithWatermark(testEventTime, 5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// many more records than the output channel holds, which can only be
+	// written if the output is read at the same time
+	const n = 20000
+	written := make(chan error, 1)
+	go func() {
+		defer close(written)
+		for i := 0; i < n; i++ {
+			// every pair of events is swapped
+			if err := sort.Write(fmt.Sprintf("%05d-event", i^1)); err != nil {
+				written <- err
+				return
+			}
+		}
+		sort.Close()
+	}()
+	read := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			v, err := sort.Read()
+			if err != nil {
+				read <- err
+				return
+			}
+			if v == nil {
+				if i != n {
+					err = fmt.Errorf("expected %d records, but got %d", n, i)
+				}
+				read <- err
+				return
+			}
+			if exp := fmt.Sprintf("%05d-event", i); v != exp {
+				read <- fmt.Errorf("expected %s but got %v", exp, v)
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the sort hasn't finished")
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatermarkLateError(t *testing.T) {
+	sort, err := New(
+		WithLess(testLessLine),
+		WithEncoderNew(newTestLineEncoder),
+		WithDecoderNew(newTestLineDecoder),
+		WithWatermark(testEventTime, 2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Write("10-event")
+	sort.Write("05-event")
+	sort.Close()
+	if _, err := sort.Read(); err == nil {
+		t.Error("expected an error for a late record without WithLateRecords")
+	}
+}